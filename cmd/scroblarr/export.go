@@ -0,0 +1,75 @@
+package scroblarr
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/export"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"os"
+)
+
+// Export runs the export command, e.g. `scroblarr export letterboxd --from 2024-01-01`
+func Export(args []string) error {
+	if len(args) == 0 || args[0] != "letterboxd" {
+		return fmt.Errorf("usage: scroblarr export letterboxd [options]")
+	}
+
+	fs := flag.NewFlagSet("export letterboxd", flag.ContinueOnError)
+	source := fs.String("source", "ledger", "history source: ledger or a server name")
+	from := fs.String("from", "", "first watch date to export (YYYY-MM-DD)")
+	to := fs.String("to", "", "last watch date to export (YYYY-MM-DD)")
+	user := fs.String("user", "", "only export this user's history")
+	out := fs.String("out", "letterboxd.csv", "output file, - for stdout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	filter, err := export.ParseFilter(*from, *to, *user)
+	if err != nil {
+		return err
+	}
+
+	var movies []types.MediaSession
+	var ratings []types.Rating
+	if *source == "ledger" {
+		movies, err = export.FromLedger(filter)
+		if err == nil {
+			ratings, err = export.RatingsFromLedger(filter)
+		}
+	} else {
+		servers, serr := media_servers.New()
+		if serr != nil {
+			return fmt.Errorf("error creating media server clients: %v", serr)
+		}
+		server, ok := servers.Get(*source)
+		if !ok {
+			return fmt.Errorf("server %s is not configured or not reachable", *source)
+		}
+		movies, err = export.FromServer(server, filter)
+		if err == nil {
+			ratings, err = export.RatingsFromServer(server)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %w", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := export.Letterboxd(w, movies, ratings); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+	if *out != "-" {
+		fmt.Printf("Exported %d movies to %s\n", len(movies), *out)
+	}
+	return nil
+}
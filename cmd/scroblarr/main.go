@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/sirrobot01/scroblarr/internal/config"
 	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/mqtt"
 	"github.com/sirrobot01/scroblarr/internal/scrobble"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
 	"github.com/sirrobot01/scroblarr/web"
@@ -30,13 +31,26 @@ func Start(ctx context.Context) error {
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	webServer := web.New()
+	// Keep retrying servers that were unreachable at startup
+	servers.Start(ctx)
+
+	webServer := web.New(servers)
 
 	// Create a new scrobble instance
 
+	var sinks []scrobble.Sink
+	if cfg.MQTT != nil {
+		publisher, err := mqtt.New(cfg.MQTT)
+		if err != nil {
+			return fmt.Errorf("error creating mqtt publisher: %v", err)
+		}
+		defer publisher.Close()
+		sinks = append(sinks, publisher)
+	}
+
 	interval := cfg.GetInterval()
 	if interval != 0 {
-		scrobbler, err := scrobble.New(servers)
+		scrobbler, err := scrobble.New(servers, sinks...)
 		if err != nil {
 			return fmt.Errorf("error creating scrobbler: %v", err)
 		}
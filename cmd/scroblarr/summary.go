@@ -0,0 +1,71 @@
+package scroblarr
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/ledger"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Summary runs the summary command, printing what dry runs would have sent,
+// e.g. `scroblarr summary --sync plex-to-trakt --since 24h`
+func Summary(args []string) error {
+	fs := flag.NewFlagSet("summary", flag.ContinueOnError)
+	syncName := fs.String("sync", "", "only summarize this sync")
+	since := fs.Duration("since", 24*time.Hour, "how far back to look, 0 for the whole ledger")
+	list := fs.Bool("list", false, "also list every write the dry runs recorded")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := ledger.Filter{Sync: *syncName, DryRun: true}
+	if *since > 0 {
+		filter.From = time.Now().Add(-*since)
+	}
+	entries, err := ledger.Get().Query(filter)
+	if err != nil {
+		return fmt.Errorf("error reading ledger: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No dry run writes recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *list {
+		fmt.Fprintln(w, "TIME\tSYNC\tTARGET\tACTION\tSTATUS\tTITLE\tDETAIL")
+		for _, entry := range entries {
+			detail := entry.Detail
+			if entry.Error != "" {
+				detail = entry.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Format(time.DateTime), entry.Sync, entry.Target,
+				entry.Action, entry.Status, entry.Session.Title, detail)
+		}
+		fmt.Fprintln(w)
+	}
+
+	summary := ledger.Summarize(entries)
+	fmt.Fprintln(w, "SYNC\tTARGET\tWOULD SEND\tUNMATCHED\tFILTERED")
+	for _, name := range sortedKeys(summary.Syncs) {
+		targets := summary.Syncs[name]
+		for _, target := range sortedKeys(targets) {
+			counts := targets[target]
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", name, target, counts.WouldSend, counts.Unmatched, counts.Filtered)
+		}
+	}
+	fmt.Fprintf(w, "total\t\t%d\t%d\t%d\n", summary.WouldSend, summary.Unmatched, summary.Filtered)
+	return w.Flush()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
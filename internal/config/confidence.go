@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMinConfidence is the lowest title match score accepted when a server does not set one
+const DefaultMinConfidence = 0.85
+
+// ParseConfidence parses a match score from 0 to 1
+func ParseConfidence(value string) (float64, error) {
+	confidence, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || confidence < 0 || confidence > 1 {
+		return 0, fmt.Errorf("invalid confidence %q, expected a number from 0 to 1", value)
+	}
+	return confidence, nil
+}
+
+// GetMinConfidence returns the lowest title match score the server accepts
+func (s Server) GetMinConfidence() float64 {
+	if s.MinConfidence == "" {
+		return DefaultMinConfidence
+	}
+	confidence, err := ParseConfidence(s.MinConfidence)
+	if err != nil {
+		// Rejected by Validate, so only reachable with an unvalidated config
+		return DefaultMinConfidence
+	}
+	return confidence
+}
@@ -1,13 +1,12 @@
 package config
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,14 +15,23 @@ import (
 
 type ClientType string
 
+const (
+	DefaultTraktClientID = "4ee97aae28ec4797b76a7c97d2655286e3c113124028339c9c08d9ab12a2f81a"
+	DefaultTraktAPIURL   = "https://api.trakt.tv"
+)
+
 var (
-	instance   *Config
-	once       sync.Once
-	configPath string     = "config.yaml" // Changed file extension
-	Plex       ClientType = "plex"
-	Jellyfin   ClientType = "jellyfin"
-	Emby       ClientType = "emby"
-	Tautulli   ClientType = "tautulli"
+	instance     *Config
+	once         sync.Once
+	configPath   string     = "config.yaml" // Changed file extension
+	dryRun       bool                       // Set by the -dry-run flag, never saved to the config file
+	Plex         ClientType = "plex"
+	Jellyfin     ClientType = "jellyfin"
+	Emby         ClientType = "emby"
+	Tautulli     ClientType = "tautulli"
+	ListenBrainz ClientType = "listenbrainz"
+	Webhook      ClientType = "webhook"
+	TraktTarget  ClientType = "trakt"
 )
 
 type Server struct {
@@ -32,6 +40,18 @@ type Server struct {
 	Token    string     `yaml:"token,omitempty" json:"token,omitempty"`
 	Username string     `yaml:"username,omitempty" json:"username,omitempty"`
 	Password string     `yaml:"password,omitempty" json:"password,omitempty"`
+
+	// Webhook options
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`   // Extra request headers
+	Template string            `yaml:"template,omitempty" json:"template,omitempty"` // Go text/template for the request body
+	Secret   string            `yaml:"secret,omitempty" json:"secret,omitempty"`     // HMAC-SHA256 signing secret
+
+	// Request limits, e.g. "10/s" or "1000/5m"
+	RateLimit      string `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	WriteRateLimit string `yaml:"write_rate_limit,omitempty" json:"write_rate_limit,omitempty"` // Applies to requests other than GET, on top of RateLimit
+
+	// MinConfidence is the lowest title match score, from 0 to 1, accepted when an item is looked up without external IDs
+	MinConfidence string `yaml:"min_confidence,omitempty" json:"min_confidence,omitempty"`
 }
 
 type Trakt struct {
@@ -39,15 +59,115 @@ type Trakt struct {
 	Interval     *string `yaml:"interval,omitempty" json:"interval,omitempty"`
 	AccessToken  string  `yaml:"access_token,omitempty" json:"access_token,omitempty"`
 	RefreshToken string  `yaml:"refresh_token,omitempty" json:"refresh_token,omitempty"`
-	ExpiresIn    int     `yaml:"expires_in,omitempty" json:"expires_in,omitempty"`
+	ExpiresIn    int     `yaml:"expires_in,omitempty" json:"expires_in,omitempty"` // Seconds from CreatedAt
+	CreatedAt    int64   `yaml:"created_at,omitempty" json:"created_at,omitempty"` // Unix time the access token was issued
 	TokenType    string  `yaml:"token_type,omitempty" json:"token_type,omitempty"`
+	AuthError    string  `yaml:"auth_error,omitempty" json:"auth_error,omitempty"` // Set when the login expired or was revoked
+}
+
+// ExpiresAt returns when the access token expires, or the zero time if its creation time is unknown
+func (t *Trakt) ExpiresAt() time.Time {
+	if t.CreatedAt == 0 || t.ExpiresIn == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t.CreatedAt+int64(t.ExpiresIn), 0)
+}
+
+// NeedsRefresh reports whether less than a quarter of the access token's lifetime is left
+func (t *Trakt) NeedsRefresh() bool {
+	expiresAt := t.ExpiresAt()
+	if expiresAt.IsZero() || t.RefreshToken == "" {
+		return false
+	}
+	return time.Until(expiresAt) < time.Duration(t.ExpiresIn)*time.Second/4
 }
 
 type Sync struct {
-	Name     string   `yaml:"name,omitempty" json:"name,omitempty"`       // Name of the sync destination
-	Source   string   `yaml:"source,omitempty" json:"source,omitempty"`   // Source server name
-	Targets  []string `yaml:"targets,omitempty" json:"targets,omitempty"` // List of target server names
-	Interval *string  `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Name       string     `yaml:"name,omitempty" json:"name,omitempty"`       // Name of the sync destination
+	Source     string     `yaml:"source,omitempty" json:"source,omitempty"`   // Source server name
+	Targets    []string   `yaml:"targets,omitempty" json:"targets,omitempty"` // List of target server names
+	Interval   *string    `yaml:"interval,omitempty" json:"interval,omitempty"`
+	History    bool       `yaml:"history,omitempty" json:"history,omitempty"`         // Also copy new plays from the source's history to the targets
+	Ratings    string     `yaml:"ratings,omitempty" json:"ratings,omitempty"`         // "one-way" or "two-way" to sync user ratings, off if empty
+	Watchlist  *Watchlist `yaml:"watchlist,omitempty" json:"watchlist,omitempty"`     // Mirror the source's watchlist to the targets
+	Collection bool       `yaml:"collection,omitempty" json:"collection,omitempty"`   // Add the movies and episodes in the source's libraries to the targets' collections
+	Resume     bool       `yaml:"resume,omitempty" json:"resume,omitempty"`           // Copy where playback stopped to the targets instead of reporting a stopped session
+	Unwatched  bool       `yaml:"unwatched,omitempty" json:"unwatched,omitempty"`     // Mark items unwatched on the source unwatched on the targets
+	PlayCounts bool       `yaml:"play_counts,omitempty" json:"play_counts,omitempty"` // Bring the targets' play counts and last played dates up to the source's
+	// ResumeMinOffset is the position an item must be stopped past for it to be copied, e.g. "2m"
+	ResumeMinOffset string `yaml:"resume_min_offset,omitempty" json:"resume_min_offset,omitempty"`
+	DryRun          bool   `yaml:"dry_run,omitempty" json:"dry_run,omitempty"` // Record the writes to the targets in the ledger instead of sending them
+}
+
+// DefaultResumeMinOffset is the resume position below which a stopped item counts as not started
+const DefaultResumeMinOffset = time.Minute
+
+// GetResumeMinOffset returns the resume position below which a stopped item is not copied
+func (s *Sync) GetResumeMinOffset() time.Duration {
+	if s.ResumeMinOffset == "" {
+		return DefaultResumeMinOffset
+	}
+	offset, err := time.ParseDuration(s.ResumeMinOffset)
+	if err != nil {
+		return DefaultResumeMinOffset
+	}
+	return offset
+}
+
+// Watchlist mirrors the unwatched items of a Trakt watchlist to a list in each target's library
+type Watchlist struct {
+	Name    string `yaml:"name,omitempty" json:"name,omitempty"`       // Plex collection name, Emby and Jellyfin use the user's favorites
+	Reverse bool   `yaml:"reverse,omitempty" json:"reverse,omitempty"` // Also add items added to the list on a target to the watchlist
+}
+
+// DefaultWatchlistName is the Plex collection the watchlist is mirrored to when no name is set
+const DefaultWatchlistName = "Trakt Watchlist"
+
+// GetName returns the name of the list the watchlist is mirrored to
+func (w *Watchlist) GetName() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	return DefaultWatchlistName
+}
+
+var (
+	RatingsOneWay = "one-way" // Ratings changed on the source are written to the targets
+	RatingsTwoWay = "two-way" // The newest rating of an item on any side wins
+)
+
+// Episode orders a server may number the episodes of a show in
+var (
+	EpisodeOrderAired    = "aired"    // Seasons and episodes as first aired, the default
+	EpisodeOrderAbsolute = "absolute" // One count across all seasons
+	EpisodeOrderDVD      = "dvd"      // Seasons and episodes as released on disc
+	EpisodeOrderDate     = "date"     // Identified by air date, e.g. daily shows
+)
+
+// EpisodeOrder sets the episode order of a show on some servers. The show is matched
+// by its IMDB or TVDB ID when given, and by title otherwise.
+type EpisodeOrder struct {
+	Show    string            `yaml:"show,omitempty" json:"show,omitempty"`
+	IMDB    string            `yaml:"imdb,omitempty" json:"imdb,omitempty"`
+	TVDB    string            `yaml:"tvdb,omitempty" json:"tvdb,omitempty"`
+	Servers map[string]string `yaml:"servers,omitempty" json:"servers,omitempty"` // Server name to episode order
+}
+
+// MQTT configures the MQTT sink, which publishes every session state change to a broker
+type MQTT struct {
+	Broker          string `yaml:"broker,omitempty" json:"broker,omitempty"` // e.g. tcp://localhost:1883 or ssl://broker:8883
+	Username        string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password        string `yaml:"password,omitempty" json:"password,omitempty"`
+	ClientID        string `yaml:"client_id,omitempty" json:"client_id,omitempty"`
+	TopicPrefix     string `yaml:"topic_prefix,omitempty" json:"topic_prefix,omitempty"`
+	Discovery       bool   `yaml:"discovery,omitempty" json:"discovery,omitempty"` // Publish Home Assistant discovery config
+	DiscoveryPrefix string `yaml:"discovery_prefix,omitempty" json:"discovery_prefix,omitempty"`
+	TLS             struct {
+		CA                 string `yaml:"ca,omitempty" json:"ca,omitempty"`
+		Cert               string `yaml:"cert,omitempty" json:"cert,omitempty"`
+		Key                string `yaml:"key,omitempty" json:"key,omitempty"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+	} `yaml:"tls,omitempty" json:"tls,omitempty"`
 }
 
 type Config struct {
@@ -57,22 +177,85 @@ type Config struct {
 	TraktDetails struct {
 		ClientID     string `yaml:"client_id,omitempty" json:"client_id,omitempty"`
 		ClientSecret string `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+		APIURL       string `yaml:"api_url,omitempty" json:"api_url,omitempty"` // Overrides the Trakt API, e.g. for local testing
 	} `yaml:"trakt,omitempty" json:"trakt,omitempty"` // Trakt details, if enabled
 	Interval string `yaml:"interval,omitempty" json:"interval,omitempty"`
 	Sync     []Sync `yaml:"sync,omitempty" json:"sync,omitempty"` // List of sync configurations
+	MQTT     *MQTT  `yaml:"mqtt,omitempty" json:"mqtt,omitempty"` // MQTT sink, disabled if not set
+	// EpisodeOrders lists the shows some servers number differently, e.g. anime in absolute order
+	EpisodeOrders []EpisodeOrder `yaml:"episode_orders,omitempty" json:"episode_orders,omitempty"`
+	// DryRun runs every sync as a dry run, recording the writes to the targets instead of sending them
+	DryRun bool `yaml:"dry_run,omitempty" json:"dry_run,omitempty"`
+	// IDMapping is a JSON file of known ID cross-references, relative to the config folder unless absolute
+	IDMapping string `yaml:"id_mapping,omitempty" json:"id_mapping,omitempty"`
+	// Web is the login of the Settings page, which stays disabled without one
+	Web struct {
+		Username string `yaml:"username,omitempty" json:"-"`
+		Password string `yaml:"password,omitempty" json:"-"`
+	} `yaml:"web,omitempty" json:"-"`
 	Path     string `yaml:"-" json:"-"`
 	LogLevel string `yaml:"log_level,omitempty" json:"log_level,omitempty"`
 	Port     int    `yaml:"port,omitempty" json:"port,omitempty"`
+
+	warnings []string // Found by Validate
 }
 
+// GetIDMappingPath returns the path of the ID mapping file, or "" if none is configured
+func (c *Config) GetIDMappingPath() string {
+	if c.IDMapping == "" || filepath.IsAbs(c.IDMapping) {
+		return c.IDMapping
+	}
+	return filepath.Join(c.Path, c.IDMapping)
+}
+
+// GetTraktClientID returns the client ID of the Trakt app from the config,
+// the TRAKT_CLIENT_ID environment variable, or Scroblarr's default app
 func (c *Config) GetTraktClientID() string {
-	return ""
+	if c.TraktDetails.ClientID != "" {
+		return c.TraktDetails.ClientID
+	}
+	if id := os.Getenv("TRAKT_CLIENT_ID"); id != "" {
+		return id
+	}
+	return DefaultTraktClientID
+}
+
+// GetTraktClientSecret returns the client secret of the Trakt app from the config
+// or the TRAKT_CLIENT_SECRET environment variable
+func (c *Config) GetTraktClientSecret() string {
+	if c.TraktDetails.ClientSecret != "" {
+		return c.TraktDetails.ClientSecret
+	}
+	return os.Getenv("TRAKT_CLIENT_SECRET")
+}
+
+// GetTraktAPIURL returns the base URL of the Trakt API from the config,
+// the TRAKT_API_URL environment variable, or the public API
+func (c *Config) GetTraktAPIURL() string {
+	url := c.TraktDetails.APIURL
+	if url == "" {
+		url = os.Getenv("TRAKT_API_URL")
+	}
+	if url == "" {
+		url = DefaultTraktAPIURL
+	}
+	return strings.TrimSuffix(url, "/")
 }
 
 func SetConfigPath(path string) {
 	configPath = path
 }
 
+// SetDryRun runs every sync as a dry run, whatever the config file says
+func SetDryRun(enabled bool) {
+	dryRun = enabled
+}
+
+// IsDryRun reports whether a sync only records what it would send to its targets
+func (c *Config) IsDryRun(sync Sync) bool {
+	return dryRun || c.DryRun || sync.DryRun
+}
+
 func Get() *Config {
 	once.Do(func() {
 		instance = &Config{}
@@ -119,6 +302,17 @@ func (c *Config) loadConfig() error {
 	if c.Port == 0 {
 		c.Port = 8080
 	}
+	if c.MQTT != nil {
+		if c.MQTT.TopicPrefix == "" {
+			c.MQTT.TopicPrefix = "scroblarr"
+		}
+		if c.MQTT.DiscoveryPrefix == "" {
+			c.MQTT.DiscoveryPrefix = "homeassistant"
+		}
+		if c.MQTT.ClientID == "" {
+			c.MQTT.ClientID = "scroblarr"
+		}
+	}
 
 	c.TraktEnabled = false
 
@@ -129,6 +323,14 @@ func (c *Config) loadConfig() error {
 		c.Trakt = trakt
 	}
 
+	// Syncs used to reference "trakt" without a server entry, which stands for the authorized account
+	if _, ok := c.Servers["trakt"]; !ok && c.TraktEnabled && c.usesTarget("trakt") {
+		if c.Servers == nil {
+			c.Servers = make(map[string]Server)
+		}
+		c.Servers["trakt"] = Server{Type: TraktTarget}
+	}
+
 	// Validate required fields
 	if err := c.Validate(); err != nil {
 		return err
@@ -157,21 +359,17 @@ func (c *Config) Create() error {
 	return nil
 }
 
+// Validate checks the config, and records the warnings of a valid one
 func (c *Config) Validate() error {
+	c.warnings = nil
 	if len(c.Servers) == 0 {
 		return errors.New("no servers configured")
 	}
 
 	// Validate each client
 	for name, server := range c.Servers {
-		if server.URL == "" {
-			return fmt.Errorf("server %s URL is required", name)
-		}
-		if server.Type == "" {
-			return fmt.Errorf("server %s type is required", name)
-		}
-		if server.Type != Plex && server.Type != Jellyfin && server.Type != Emby {
-			return fmt.Errorf("server %s has an invalid type: %s", name, server.Type)
+		if err := validateServer(name, server); err != nil {
+			return err
 		}
 	}
 
@@ -186,20 +384,143 @@ func (c *Config) Validate() error {
 		//if len(_sync.Targets) == 0 {
 		//	return fmt.Errorf("sync %s targets are required", _sync.Name)
 		//}
+		if err := c.requireCapability(_sync.Name, "source", _sync.Source, CapabilitySessions); err != nil {
+			return err
+		}
+		if _sync.History {
+			if err := c.requireCapability(_sync.Name, "source", _sync.Source, CapabilityHistory); err != nil {
+				return err
+			}
+		}
+		switch _sync.Ratings {
+		case "":
+		case RatingsOneWay, RatingsTwoWay:
+			if err := c.requireCapability(_sync.Name, "source", _sync.Source, CapabilityRatings); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("sync %s ratings must be %s or %s", _sync.Name, RatingsOneWay, RatingsTwoWay)
+		}
+		if _sync.Watchlist != nil {
+			if err := c.requireCapability(_sync.Name, "source", _sync.Source, CapabilityWatchlist); err != nil {
+				return err
+			}
+		}
+		if _sync.Collection {
+			if err := c.requireCapability(_sync.Name, "source", _sync.Source, CapabilityLibrary); err != nil {
+				return err
+			}
+		}
+		if _sync.Unwatched || _sync.PlayCounts {
+			if err := c.requireCapability(_sync.Name, "source", _sync.Source, CapabilityPlayed); err != nil {
+				return err
+			}
+		}
 		for _, target := range _sync.Targets {
 			if target == "" {
 				return fmt.Errorf("sync %s has an empty target", _sync.Name)
 			}
+			if target == _sync.Source {
+				continue
+			}
+			if err := c.requireCapability(_sync.Name, "target", target, CapabilityScrobble); err != nil {
+				return err
+			}
+			if _sync.History {
+				if err := c.requireCapability(_sync.Name, "target", target, CapabilityHistoryWrite); err != nil {
+					return err
+				}
+			}
+			if _sync.Ratings != "" {
+				if err := c.requireCapability(_sync.Name, "target", target, CapabilityRatings); err != nil {
+					return err
+				}
+			}
+			if _sync.Watchlist != nil {
+				if err := c.requireCapability(_sync.Name, "target", target, CapabilityListMirror); err != nil {
+					return err
+				}
+			}
+			if _sync.Collection {
+				if err := c.requireCapability(_sync.Name, "target", target, CapabilityCollection); err != nil {
+					return err
+				}
+			}
+			if _sync.Unwatched {
+				if err := c.requireCapability(_sync.Name, "target", target, CapabilityUnwatch); err != nil {
+					return err
+				}
+			}
+			if _sync.PlayCounts {
+				if err := c.requireCapability(_sync.Name, "target", target, CapabilityPlayCount); err != nil {
+					return err
+				}
+			}
+		}
+		if _sync.ResumeMinOffset != "" {
+			if offset, err := time.ParseDuration(_sync.ResumeMinOffset); err != nil || offset < 0 {
+				return fmt.Errorf("sync %s resume_min_offset must be a duration such as 2m", _sync.Name)
+			}
 		}
 		if _sync.Interval != nil && *_sync.Interval == "0" {
 			return fmt.Errorf("sync %s interval cannot be zero", _sync.Name)
 		}
 	}
 
+	if c.MQTT != nil && c.MQTT.Broker == "" {
+		return errors.New("mqtt broker is required")
+	}
+
+	for i, order := range c.EpisodeOrders {
+		if order.Show == "" && order.IMDB == "" && order.TVDB == "" {
+			return fmt.Errorf("episode order %d needs a show, imdb or tvdb", i+1)
+		}
+		for server, value := range order.Servers {
+			if _, ok := c.Servers[server]; !ok {
+				return fmt.Errorf("episode order %d refers to unknown server %s", i+1, server)
+			}
+			switch value {
+			case EpisodeOrderAired, EpisodeOrderAbsolute, EpisodeOrderDVD, EpisodeOrderDate:
+			default:
+				return fmt.Errorf("episode order %d on %s must be %s, %s, %s or %s", i+1, server,
+					EpisodeOrderAired, EpisodeOrderAbsolute, EpisodeOrderDVD, EpisodeOrderDate)
+			}
+		}
+	}
+
+	if c.IDMapping != "" {
+		if _, err := os.Stat(c.GetIDMappingPath()); err != nil {
+			return fmt.Errorf("invalid id_mapping: %w", err)
+		}
+	}
+
+	c.warnings = c.cycleWarnings()
 	return nil
 }
 
+// usesTarget reports whether any sync sends to the named server
+func (c *Config) usesTarget(name string) bool {
+	for _, s := range c.Sync {
+		for _, target := range s.Targets {
+			if target == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (c *Config) Save() error {
+	if err := c.Write(); err != nil {
+		return err
+	}
+	// Update the instance
+	instance = c
+	return nil
+}
+
+// Write saves the config file without applying it, the changes take effect on the next start
+func (c *Config) Write() error {
 	data, err := yaml.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("error encoding config: %w", err)
@@ -207,8 +528,6 @@ func (c *Config) Save() error {
 	if err := os.WriteFile(c.configFilePath(), data, 0644); err != nil {
 		return fmt.Errorf("error writing config file: %w", err)
 	}
-	// Update the instance
-	instance = c
 	return nil
 }
 
@@ -231,7 +550,12 @@ func (c *Config) SaveTrakt() error {
 	if err != nil {
 		return fmt.Errorf("error encoding trakt config: %w", err)
 	}
-	if err := os.WriteFile(filepath.Join(c.Path, "trakt.json"), data, 0644); err != nil {
+	// Write to a temporary file first, so a crash never loses the tokens
+	path := filepath.Join(c.Path, "trakt.json")
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("error writing trakt config file: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
 		return fmt.Errorf("error writing trakt config file: %w", err)
 	}
 	return nil
@@ -251,29 +575,3 @@ func (c *Config) loadTrakt() (*Trakt, error) {
 	}
 	return trakt, nil
 }
-
-func (c *Config) RefreshTrakt() error {
-	// Make request to Trakt API to get device code
-	payload := map[string]string{
-		"client_id": "4ee97aae28ec4797b76a7c97d2655286e3c113124028339c9c08d9ab12a2f81a",
-	}
-	jsonPayload, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest("POST", "https://api.trakt.tv/oauth/device/code", bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	_, err = client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to contact Trakt API: %w", err)
-	}
-	if err := c.SaveTrakt(); err != nil {
-		return fmt.Errorf("error saving trakt config: %w", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SyncCycle is a loop in the sync graph, e.g. plex to jellyfin and back
+type SyncCycle struct {
+	Servers []string // The servers of the loop, starting and ending with the same one
+	Syncs   []string // The syncs copying along the loop
+}
+
+func (c SyncCycle) String() string {
+	return fmt.Sprintf("%s (syncs %s)", strings.Join(c.Servers, " -> "), strings.Join(c.Syncs, ", "))
+}
+
+// SyncCycles returns the loops in the graph of sources and targets of the syncs. Changes copied
+// along a loop come back to the server they started from.
+func (c *Config) SyncCycles() []SyncCycle {
+	edges := make(map[string]map[string][]string) // Source to target to the syncs between them
+	for _, sync := range c.Sync {
+		for _, target := range sync.Targets {
+			if target == sync.Source {
+				continue
+			}
+			if edges[sync.Source] == nil {
+				edges[sync.Source] = make(map[string][]string)
+			}
+			edges[sync.Source][target] = append(edges[sync.Source][target], sync.Name)
+		}
+	}
+	servers := make([]string, 0, len(edges))
+	for server := range edges {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+
+	// Each loop is found once, from its first server in name order
+	cycles := make([]SyncCycle, 0)
+	var visit func(start string, path []string)
+	visit = func(start string, path []string) {
+		from := path[len(path)-1]
+		targets := make([]string, 0, len(edges[from]))
+		for target := range edges[from] {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		for _, target := range targets {
+			switch {
+			case target == start:
+				cycles = append(cycles, newSyncCycle(append(path, start), edges))
+			case target > start && !slices.Contains(path, target):
+				visit(start, append(path[:len(path):len(path)], target))
+			}
+		}
+	}
+	for _, server := range servers {
+		visit(server, []string{server})
+	}
+	return cycles
+}
+
+func newSyncCycle(servers []string, edges map[string]map[string][]string) SyncCycle {
+	cycle := SyncCycle{Servers: append([]string(nil), servers...)}
+	seen := make(map[string]bool)
+	for i := 1; i < len(servers); i++ {
+		for _, name := range edges[servers[i-1]][servers[i]] {
+			if !seen[name] {
+				seen[name] = true
+				cycle.Syncs = append(cycle.Syncs, name)
+			}
+		}
+	}
+	return cycle
+}
+
+// Warnings returns the problems Validate found in a valid config that are worth pointing out, such as
+// loops between syncs
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+// cycleWarnings describes the loops between syncs
+func (c *Config) cycleWarnings() []string {
+	warnings := make([]string, 0)
+	for _, cycle := range c.SyncCycles() {
+		warnings = append(warnings, fmt.Sprintf("sync loop %s: Scroblarr's own writes are not copied back to the server they came from, and changes made there to the same items shortly after are skipped too", cycle))
+	}
+	return warnings
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSyncCycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		syncs []Sync
+		want  []SyncCycle
+	}{
+		{name: "no syncs", want: []SyncCycle{}},
+		{
+			name: "one way",
+			syncs: []Sync{
+				{Name: "plex-trakt", Source: "plex", Targets: []string{"trakt", "jellyfin"}},
+				{Name: "jellyfin-trakt", Source: "jellyfin", Targets: []string{"trakt"}},
+			},
+			want: []SyncCycle{},
+		},
+		{
+			name:  "target is the source",
+			syncs: []Sync{{Name: "plex", Source: "plex", Targets: []string{"plex"}}},
+			want:  []SyncCycle{},
+		},
+		{
+			name: "both ways",
+			syncs: []Sync{
+				{Name: "plex-jellyfin", Source: "plex", Targets: []string{"jellyfin"}},
+				{Name: "jellyfin-plex", Source: "jellyfin", Targets: []string{"plex"}},
+			},
+			want: []SyncCycle{
+				{Servers: []string{"jellyfin", "plex", "jellyfin"}, Syncs: []string{"jellyfin-plex", "plex-jellyfin"}},
+			},
+		},
+		{
+			name: "around three servers",
+			syncs: []Sync{
+				{Name: "a", Source: "plex", Targets: []string{"emby"}},
+				{Name: "b", Source: "emby", Targets: []string{"jellyfin"}},
+				{Name: "c", Source: "jellyfin", Targets: []string{"plex", "trakt"}},
+			},
+			want: []SyncCycle{
+				{Servers: []string{"emby", "jellyfin", "plex", "emby"}, Syncs: []string{"b", "c", "a"}},
+			},
+		},
+		{
+			name: "several loops and syncs along the same way",
+			syncs: []Sync{
+				{Name: "a", Source: "plex", Targets: []string{"emby", "jellyfin"}},
+				{Name: "b", Source: "plex", Targets: []string{"emby"}},
+				{Name: "c", Source: "emby", Targets: []string{"plex"}},
+				{Name: "d", Source: "jellyfin", Targets: []string{"plex"}},
+			},
+			want: []SyncCycle{
+				{Servers: []string{"emby", "plex", "emby"}, Syncs: []string{"c", "a", "b"}},
+				{Servers: []string{"jellyfin", "plex", "jellyfin"}, Syncs: []string{"d", "a"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Sync: tt.syncs}
+			got := c.SyncCycles()
+			if len(got) != len(tt.want) {
+				t.Fatalf("SyncCycles() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !slices.Equal(got[i].Servers, tt.want[i].Servers) || !slices.Equal(got[i].Syncs, tt.want[i].Syncs) {
+					t.Errorf("cycle %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
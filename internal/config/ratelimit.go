@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"golang.org/x/time/rate"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseRateLimit parses a number of requests per period, such as "10/s" or "1000/5m"
+func ParseRateLimit(value string) (rate.Limit, error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid rate limit %q, expected requests/period such as 10/s", value)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate limit %q, the number of requests must be positive", value)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil || per <= 0 {
+		return 0, fmt.Errorf("invalid rate limit %q, the period must be a duration such as s or 5m", value)
+	}
+	return rate.Every(per / time.Duration(n)), nil
+}
+
+// NewRateLimiter creates a limiter from a rate limit such as "10/s", allowing no bursts. It returns nil,
+// no limit, for an empty value, and for an invalid one, which Validate rejects.
+func NewRateLimiter(value string) *rate.Limiter {
+	if value == "" {
+		return nil
+	}
+	limit, err := ParseRateLimit(value)
+	if err != nil {
+		return nil
+	}
+	return rate.NewLimiter(limit, 1)
+}
+
+// RateLimiter returns the limiter of every request to the server, or nil
+func (s Server) RateLimiter() *rate.Limiter {
+	return NewRateLimiter(s.RateLimit)
+}
+
+// WriteRateLimiter returns the limiter of the requests changing data on the server, or nil
+func (s Server) WriteRateLimiter() *rate.Limiter {
+	return NewRateLimiter(s.WriteRateLimit)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    rate.Limit
+		wantErr bool
+	}{
+		{"10/s", rate.Every(100 * time.Millisecond), false},
+		{"1000/5m", rate.Every(300 * time.Millisecond), false},
+		{" 1/2s ", rate.Every(2 * time.Second), false},
+		{"10", 0, true},
+		{"0/s", 0, true},
+		{"-1/s", 0, true},
+		{"ten/s", 0, true},
+		{"10/fortnight", 0, true},
+		{"10/0s", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRateLimit(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRateLimit(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	if NewRateLimiter("") != nil || NewRateLimiter("fast") != nil {
+		t.Error("an empty or invalid rate limit created a limiter")
+	}
+	limiter := NewRateLimiter("2/s")
+	if limiter == nil || limiter.Limit() != rate.Every(500*time.Millisecond) || limiter.Burst() != 1 {
+		t.Errorf("NewRateLimiter(\"2/s\") = %+v", limiter)
+	}
+}
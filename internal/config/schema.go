@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FieldKind tells the settings UI how to render a field
+type FieldKind string
+
+var (
+	FieldText     FieldKind = "text"
+	FieldURL      FieldKind = "url"
+	FieldPassword FieldKind = "password"
+	FieldTextArea FieldKind = "textarea"
+	FieldMap      FieldKind = "map"
+)
+
+// Capability is something a server type can do, beyond connecting
+type Capability string
+
+var (
+	CapabilitySessions     Capability = "sessions"      // Reports currently playing sessions
+	CapabilityHistory      Capability = "history"       // Reads watch history
+	CapabilityScrobble     Capability = "scrobble"      // Receives live playback progress
+	CapabilityHistoryWrite Capability = "history_write" // Records completed plays
+	CapabilityRatings      Capability = "ratings"       // Reads and writes user ratings
+	CapabilityWatchlist    Capability = "watchlist"     // Reads and adds to a watchlist
+	CapabilityListMirror   Capability = "list_mirror"   // Keeps a collection or favorites in the library in sync with a watchlist
+	CapabilityLibrary      Capability = "library"       // Lists the movies and episodes in its libraries
+	CapabilityCollection   Capability = "collection"    // Records the movies and episodes the user owns
+	CapabilityResume       Capability = "resume"        // Stores where the user left off an item
+	CapabilityPlayed       Capability = "played"        // Lists the watched movies and episodes
+	CapabilityUnwatch      Capability = "unwatch"       // Marks movies and episodes unwatched
+	CapabilityPlayCount    Capability = "play_count"    // Adds plays to watched items and dates the last one
+)
+
+// Field describes a Server option used by a server type
+type Field struct {
+	Name        string    `json:"name"` // yaml/json key of the option in Server
+	Label       string    `json:"label"`
+	Kind        FieldKind `json:"kind"`
+	Required    bool      `json:"required,omitempty"`
+	Placeholder string    `json:"placeholder,omitempty"`
+	Help        string    `json:"help,omitempty"`
+}
+
+// RateLimitFields are the request limit options, for server types talking to an HTTP API
+var RateLimitFields = []Field{
+	{Name: "rate_limit", Label: "Rate limit", Kind: FieldText, Placeholder: "10/s", Help: "Requests per period, e.g. 10/s or 1000/5m"},
+	{Name: "write_rate_limit", Label: "Write rate limit", Kind: FieldText, Placeholder: "1/s", Help: "Limit for requests that change data"},
+}
+
+// MatchFields are the title matching options, for server types looking items up by title
+var MatchFields = []Field{
+	{Name: "min_confidence", Label: "Minimum match confidence", Kind: FieldText, Placeholder: "0.85", Help: "From 0 to 1. Items matched by title with a lower score are not sent"},
+}
+
+// ServerType is the config schema of a registered server or target type
+type ServerType struct {
+	Name   ClientType `json:"name"`
+	Label  string     `json:"label"`
+	Fields []Field    `json:"fields"`
+	// Capabilities lists what servers of this type implement, checked against the syncs using them
+	Capabilities []Capability `json:"capabilities"`
+	// Validate checks rules the fields alone cannot express, e.g. one of two auth methods
+	Validate func(server Server) error `json:"-"`
+}
+
+var (
+	serverTypes     = make(map[ClientType]ServerType)
+	serverTypesLock sync.RWMutex
+)
+
+// RegisterServerType adds a server type to the schema used by Validate
+func RegisterServerType(t ServerType) {
+	serverTypesLock.Lock()
+	defer serverTypesLock.Unlock()
+	serverTypes[t.Name] = t
+}
+
+// GetServerType returns the schema of a server type
+func GetServerType(name ClientType) (ServerType, bool) {
+	serverTypesLock.RLock()
+	defer serverTypesLock.RUnlock()
+	t, ok := serverTypes[name]
+	return t, ok
+}
+
+// ServerTypes returns the schemas of all registered server types, sorted by name
+func ServerTypes() []ServerType {
+	serverTypesLock.RLock()
+	defer serverTypesLock.RUnlock()
+	types := make([]ServerType, 0, len(serverTypes))
+	for _, t := range serverTypes {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+// Supports reports whether servers of this type have a capability
+func (t ServerType) Supports(capability Capability) bool {
+	for _, c := range t.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// HasValue reports whether a Server option is set, by its yaml/json key
+func (s Server) HasValue(field string) bool {
+	switch field {
+	case "url":
+		return s.URL != ""
+	case "token":
+		return s.Token != ""
+	case "username":
+		return s.Username != ""
+	case "password":
+		return s.Password != ""
+	case "headers":
+		return len(s.Headers) > 0
+	case "template":
+		return s.Template != ""
+	case "secret":
+		return s.Secret != ""
+	case "rate_limit":
+		return s.RateLimit != ""
+	case "write_rate_limit":
+		return s.WriteRateLimit != ""
+	case "min_confidence":
+		return s.MinConfidence != ""
+	default:
+		return false
+	}
+}
+
+// validateServer checks a server against the schema of its type
+func validateServer(name string, server Server) error {
+	if server.Type == "" {
+		return fmt.Errorf("server %s type is required", name)
+	}
+	t, ok := GetServerType(server.Type)
+	if !ok {
+		return fmt.Errorf("server %s has an invalid type: %s", name, server.Type)
+	}
+	for _, field := range t.Fields {
+		if field.Required && !server.HasValue(field.Name) {
+			return fmt.Errorf("server %s %s is required", name, field.Label)
+		}
+	}
+	for _, limit := range []string{server.RateLimit, server.WriteRateLimit} {
+		if limit == "" {
+			continue
+		}
+		if _, err := ParseRateLimit(limit); err != nil {
+			return fmt.Errorf("server %s: %w", name, err)
+		}
+	}
+	if server.MinConfidence != "" {
+		if _, err := ParseConfidence(server.MinConfidence); err != nil {
+			return fmt.Errorf("server %s: %w", name, err)
+		}
+	}
+	if t.Validate != nil {
+		if err := t.Validate(server); err != nil {
+			return fmt.Errorf("server %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// requireCapability checks that a server used by a sync supports what the sync asks of it.
+// Servers that are not configured are skipped here, the sync ignores them at runtime.
+func (c *Config) requireCapability(syncName, role, name string, capability Capability) error {
+	server, ok := c.Servers[name]
+	if !ok {
+		return nil
+	}
+	t, ok := GetServerType(server.Type)
+	if !ok {
+		return nil
+	}
+	if !t.Supports(capability) {
+		return fmt.Errorf("sync %s %s %s (%s) does not support %s", syncName, role, name, t.Label, capability)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/ledger"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// letterboxdHeader is the column layout of Letterboxd's import format
+var letterboxdHeader = []string{"imdbID", "Title", "Year", "WatchedDate", "Rating10", "Rewatch"}
+
+// Filter narrows down the exported history. Zero values match everything.
+type Filter struct {
+	From time.Time
+	To   time.Time
+	User string
+}
+
+// ParseFilter builds a filter from YYYY-MM-DD dates, both inclusive
+func ParseFilter(from, to, user string) (Filter, error) {
+	filter := Filter{User: user}
+	if from != "" {
+		t, err := time.ParseInLocation(time.DateOnly, from, time.Local)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date %q: %w", from, err)
+		}
+		filter.From = t
+	}
+	if to != "" {
+		t, err := time.ParseInLocation(time.DateOnly, to, time.Local)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date %q: %w", to, err)
+		}
+		filter.To = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return filter, nil
+}
+
+func (f Filter) match(movie types.MediaSession) bool {
+	if movie.Type != "movie" {
+		return false
+	}
+	watched := time.Unix(movie.ViewedAt, 0)
+	if !f.From.IsZero() && watched.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && watched.After(f.To) {
+		return false
+	}
+	if f.User != "" && !strings.EqualFold(movie.User.Username, f.User) {
+		return false
+	}
+	return true
+}
+
+// FromLedger returns the movies completed through Scroblarr's syncs
+func FromLedger(filter Filter) ([]types.MediaSession, error) {
+	entries, err := ledger.Get().Query(ledger.Filter{
+		User:   filter.User,
+		Type:   "movie",
+		Status: ledger.StatusSent,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A play is recorded once per target, only keep one of them
+	seen := make(map[string]bool)
+	movies := make([]types.MediaSession, 0)
+	for _, entry := range entries {
+		// Live scrobbles are recorded as "stop", plays copied from a source's history as "scrobble"
+		if entry.Action != "stop" && entry.Action != "scrobble" {
+			continue
+		}
+		movie := entry.Session
+		if movie.ViewedAt == 0 {
+			movie.ViewedAt = entry.Time.Unix()
+		}
+		key := fmt.Sprintf("%s-%s-%s", entry.Source, types.GetHistoryKey(movie), time.Unix(movie.ViewedAt, 0).Format(time.DateOnly))
+		if seen[key] || !filter.match(movie) {
+			continue
+		}
+		seen[key] = true
+		movies = append(movies, movie)
+	}
+	return movies, nil
+}
+
+// FromServer returns the movies in a server's watch history
+func FromServer(server media_servers.Server, filter Filter) ([]types.MediaSession, error) {
+	source, ok := server.(media_servers.HistorySource)
+	if !ok {
+		return nil, fmt.Errorf("%s cannot read watch history", server.GetName())
+	}
+	history, err := source.GetWatchHistory()
+	if err != nil {
+		return nil, fmt.Errorf("error getting watch history from %s: %w", server.GetName(), err)
+	}
+	movies := make([]types.MediaSession, 0)
+	for _, item := range history {
+		if filter.match(item) {
+			movies = append(movies, item)
+		}
+	}
+	return movies, nil
+}
+
+// RatingsFromLedger returns the latest movie ratings written through Scroblarr's syncs
+func RatingsFromLedger(filter Filter) ([]types.Rating, error) {
+	entries, err := ledger.Get().Query(ledger.Filter{
+		User:   filter.User,
+		Type:   "movie",
+		Action: "rate",
+		Status: ledger.StatusSent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ratings := make([]types.Rating, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Rating > 0 {
+			ratings = append(ratings, types.Rating{Session: entry.Session, Value: entry.Rating, RatedAt: entry.Time.Unix()})
+		}
+	}
+	return ratings, nil
+}
+
+// RatingsFromServer returns a server's movie ratings, or none if the server has no ratings
+func RatingsFromServer(server media_servers.Server) ([]types.Rating, error) {
+	source, ok := server.(media_servers.RatingsSync)
+	if !ok {
+		return nil, nil
+	}
+	ratings, err := source.GetRatings()
+	if err != nil {
+		return nil, fmt.Errorf("error getting ratings from %s: %w", server.GetName(), err)
+	}
+	return ratings, nil
+}
+
+// movieKey identifies a movie by its IMDB ID, or by its title and year without one
+func movieKey(movie types.MediaSession) string {
+	if movie.IDs.IMDB != "" {
+		return movie.IDs.IMDB
+	}
+	return fmt.Sprintf("%s-%d", strings.ToLower(movie.Title), movie.Year)
+}
+
+// Letterboxd writes movies in Letterboxd's CSV import format, oldest first, with the latest of their
+// ratings. Every watch of a movie after its first one is marked as a rewatch.
+func Letterboxd(w io.Writer, movies []types.MediaSession, ratings []types.Rating) error {
+	movies = slices.Clone(movies)
+	sort.SliceStable(movies, func(i, j int) bool {
+		return movies[i].ViewedAt < movies[j].ViewedAt
+	})
+
+	rated := make(map[string]types.Rating)
+	for _, rating := range ratings {
+		if rating.Session.Type != "movie" || rating.Value <= 0 {
+			continue
+		}
+		key := movieKey(rating.Session)
+		if latest, ok := rated[key]; !ok || rating.RatedAt >= latest.RatedAt {
+			rated[key] = rating
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(letterboxdHeader); err != nil {
+		return err
+	}
+	watched := make(map[string]bool)
+	for _, movie := range movies {
+		key := movieKey(movie)
+		year := ""
+		if movie.Year > 0 {
+			year = strconv.Itoa(movie.Year)
+		}
+		rating := ""
+		if r, ok := rated[key]; ok {
+			rating = strconv.Itoa(r.Value)
+		}
+		record := []string{
+			movie.IDs.IMDB,
+			movie.Title,
+			year,
+			time.Unix(movie.ViewedAt, 0).Format(time.DateOnly),
+			rating,
+			strconv.FormatBool(watched[key]),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		watched[key] = true
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,159 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Status string
+
+var (
+	instance *Ledger
+	once     sync.Once
+
+	StatusSent   Status = "sent"
+	StatusFailed Status = "failed"
+	// StatusNotFound is set when the target could not match the item
+	StatusNotFound Status = "not_found"
+	// StatusWouldSend is set in dry runs for writes that would have been sent
+	StatusWouldSend Status = "would_send"
+	// StatusFiltered is set in dry runs for writes left out, e.g. a resume position near the start
+	StatusFiltered Status = "filtered"
+)
+
+// Entry is a single scrobble sent from a source to a target
+type Entry struct {
+	Time    time.Time          `json:"time"`
+	Sync    string             `json:"sync"`
+	Source  string             `json:"source"`
+	Target  string             `json:"target"`
+	Action  string             `json:"action"`
+	Status  Status             `json:"status"`
+	Error   string             `json:"error,omitempty"`
+	Session types.MediaSession `json:"session"`
+	Rating  int                `json:"rating,omitempty"`  // The written rating of a rate entry, out of 10
+	DryRun  bool               `json:"dry_run,omitempty"` // Recorded instead of sent
+	Detail  string             `json:"detail,omitempty"`  // What a dry run would have sent, e.g. the matched item or the payload
+}
+
+// Filter narrows down the entries returned by Query. Zero values match everything.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	Sync   string
+	User   string
+	Type   string
+	Action string
+	Status Status
+	DryRun bool // Only entries of dry runs
+}
+
+func (f Filter) Match(e Entry) bool {
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	if f.Sync != "" && e.Sync != f.Sync {
+		return false
+	}
+	if f.User != "" && !strings.EqualFold(e.Session.User.Username, f.User) {
+		return false
+	}
+	if f.Type != "" && e.Session.Type != f.Type {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.Status != "" && e.Status != f.Status {
+		return false
+	}
+	if f.DryRun && !e.DryRun {
+		return false
+	}
+	return true
+}
+
+// Ledger is an append-only record of scrobbles, stored as JSON lines
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+}
+
+func New(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// Get returns the ledger stored in the config folder
+func Get() *Ledger {
+	once.Do(func() {
+		instance = New(filepath.Join(config.Get().Path, "ledger.jsonl"))
+	})
+	return instance
+}
+
+// Record appends an entry to the ledger
+func (l *Ledger) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding ledger entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening ledger: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing ledger: %w", err)
+	}
+	return nil
+}
+
+// Query returns all entries matching the filter, oldest first
+func (l *Ledger) Query(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]Entry, 0)
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening ledger: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip corrupt lines, e.g. from a partial write
+			continue
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ledger: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,70 @@
+package ledger
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// Counts are the outcomes of the writes recorded by dry runs
+type Counts struct {
+	WouldSend int `json:"would_send"`
+	Unmatched int `json:"unmatched"`
+	Filtered  int `json:"filtered"`
+}
+
+func (c *Counts) add(status Status) {
+	switch status {
+	case StatusWouldSend:
+		c.WouldSend++
+	case StatusNotFound:
+		c.Unmatched++
+	case StatusFiltered:
+		c.Filtered++
+	}
+}
+
+// Summary counts the writes recorded by dry runs, in total and by sync and target
+type Summary struct {
+	Counts
+	Syncs map[string]map[string]*Counts `json:"syncs"`
+}
+
+// Summarize counts the dry run entries among entries. A write previewed on several runs, e.g. a rating
+// compared every run, is counted once with its latest outcome. Plays are told apart by when they were
+// watched, or recorded when the source does not say.
+func Summarize(entries []Entry) Summary {
+	latest := make(map[string]Entry)
+	for _, entry := range entries {
+		if !entry.DryRun {
+			continue
+		}
+		viewedAt := entry.Session.ViewedAt
+		if viewedAt == 0 && isPlay(entry.Action) {
+			viewedAt = entry.Time.Unix()
+		}
+		key := fmt.Sprintf("%s|%s|%s|%s@%d", entry.Sync, entry.Target, entry.Action, types.GetMediaKey(entry.Session), viewedAt)
+		latest[key] = entry
+	}
+
+	summary := Summary{Syncs: make(map[string]map[string]*Counts)}
+	for _, entry := range latest {
+		targets, ok := summary.Syncs[entry.Sync]
+		if !ok {
+			targets = make(map[string]*Counts)
+			summary.Syncs[entry.Sync] = targets
+		}
+		counts, ok := targets[entry.Target]
+		if !ok {
+			counts = &Counts{}
+			targets[entry.Target] = counts
+		}
+		counts.add(entry.Status)
+		summary.add(entry.Status)
+	}
+	return summary
+}
+
+// isPlay reports whether an action sends a play, which can repeat for the same item
+func isPlay(action string) bool {
+	return action == "scrobble" || action == "stop"
+}
@@ -0,0 +1,78 @@
+package ledger
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	alien := types.MediaSession{Type: "movie", Title: "Alien", Year: 1979}
+	watched := alien
+	watched.ViewedAt = 1700000000
+	day := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	entry := func(target, action string, session types.MediaSession, status Status, at time.Time) Entry {
+		return Entry{Time: at, Sync: "plex-trakt", Target: target, Action: action, Session: session, Status: status, DryRun: true}
+	}
+
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    Counts
+		targets map[string]Counts
+	}{
+		{name: "no entries", targets: map[string]Counts{}},
+		{
+			name:    "sent writes are left out",
+			entries: []Entry{{Sync: "plex-trakt", Target: "trakt", Action: "stop", Session: alien, Status: StatusSent}},
+			targets: map[string]Counts{},
+		},
+		{
+			name: "each outcome",
+			entries: []Entry{
+				entry("trakt", "stop", alien, StatusWouldSend, day),
+				entry("trakt", "rate", alien, StatusNotFound, day),
+				entry("jellyfin", "resume", alien, StatusFiltered, day),
+			},
+			want:    Counts{WouldSend: 1, Unmatched: 1, Filtered: 1},
+			targets: map[string]Counts{"trakt": {WouldSend: 1, Unmatched: 1}, "jellyfin": {Filtered: 1}},
+		},
+		{
+			name: "write previewed every run counts once with its latest outcome",
+			entries: []Entry{
+				entry("trakt", "rate", alien, StatusNotFound, day),
+				entry("trakt", "rate", alien, StatusWouldSend, day.Add(15*time.Minute)),
+			},
+			want:    Counts{WouldSend: 1},
+			targets: map[string]Counts{"trakt": {WouldSend: 1}},
+		},
+		{
+			name: "plays watched at different times",
+			entries: []Entry{
+				entry("trakt", "scrobble", watched, StatusWouldSend, day),
+				entry("trakt", "scrobble", alien, StatusWouldSend, day),
+				entry("trakt", "stop", alien, StatusWouldSend, day),
+				entry("trakt", "stop", alien, StatusWouldSend, day.AddDate(0, 0, 1)),
+			},
+			want:    Counts{WouldSend: 4},
+			targets: map[string]Counts{"trakt": {WouldSend: 4}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := Summarize(tt.entries)
+			if summary.Counts != tt.want {
+				t.Errorf("total = %+v, want %+v", summary.Counts, tt.want)
+			}
+			targets := summary.Syncs["plex-trakt"]
+			if len(targets) != len(tt.targets) {
+				t.Fatalf("counted %d targets, want %d", len(targets), len(tt.targets))
+			}
+			for target, want := range tt.targets {
+				if got := targets[target]; got == nil || *got != want {
+					t.Errorf("%s = %+v, want %+v", target, got, want)
+				}
+			}
+		})
+	}
+}
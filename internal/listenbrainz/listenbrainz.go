@@ -0,0 +1,270 @@
+package listenbrainz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"github.com/sirrobot01/scroblarr/pkg/logger"
+	"github.com/sirrobot01/scroblarr/pkg/request"
+	"github.com/sirrobot01/scroblarr/pkg/version"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAPIRoot = "https://api.listenbrainz.org"
+
+// listenStateTTL is how long a play is remembered after it was last reported, so a stopped track
+// reported again is not submitted twice
+const listenStateTTL = 24 * time.Hour
+
+// listenState tracks what has already been submitted for a play of a track
+type listenState struct {
+	startedAt      time.Time // When the play started, set once when it is first seen
+	seenAt         time.Time // When the play was last reported
+	nowPlayingSent bool
+	listenSent     bool
+}
+
+// Client implements the Server interface for ListenBrainz
+type Client struct {
+	name    string
+	config  config.Server
+	logger  zerolog.Logger
+	client  *request.Client
+	listens map[string]*listenState
+	mu      sync.Mutex
+}
+
+func init() {
+	registry.Register(registry.Definition{
+		ServerType: config.ServerType{
+			Name:  config.ListenBrainz,
+			Label: "ListenBrainz",
+			Fields: append([]config.Field{
+				{Name: "token", Label: "User Token", Kind: config.FieldPassword, Required: true},
+				{Name: "url", Label: "API Root", Kind: config.FieldURL, Placeholder: defaultAPIRoot, Help: "For self-hosted instances"},
+			}, config.RateLimitFields...),
+			Capabilities: []config.Capability{config.CapabilityScrobble, config.CapabilityHistoryWrite},
+		},
+		New: func(name string, cfg config.Server) (registry.Server, error) {
+			return New(name, cfg)
+		},
+	})
+}
+
+// New creates a new ListenBrainz client
+func New(name string, config config.Server) (*Client, error) {
+	if config.Token == "" {
+		return nil, registry.Permanent(fmt.Errorf("missing required ListenBrainz user token"))
+	}
+	if config.URL == "" {
+		config.URL = defaultAPIRoot
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+
+	headers := map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Token " + config.Token,
+	}
+	_logger := logger.NewLogger(name)
+	client := request.New(
+		request.WithHeaders(headers),
+		request.WithLogger(_logger),
+		request.WithRateLimiter(config.RateLimiter()),
+		request.WithWriteRateLimiter(config.WriteRateLimiter()),
+	)
+
+	c := &Client{
+		name:    name,
+		config:  config,
+		logger:  _logger,
+		client:  client,
+		listens: make(map[string]*listenState),
+	}
+	if err := c.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to ListenBrainz: %w", err)
+	}
+	return c, nil
+}
+
+// GetName returns the name of the server
+func (c *Client) GetName() string {
+	return c.name
+}
+
+// GetServerType returns the type of this server
+func (c *Client) GetServerType() string {
+	return "listenbrainz"
+}
+
+func (c *Client) GetConfig() config.Server {
+	return c.config
+}
+
+// Connect validates the user token against the API
+func (c *Client) Connect() error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/1/validate-token", c.config.URL), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return registry.StatusError("listenbrainz", resp.StatusCode)
+	}
+	var info struct {
+		Valid    bool   `json:"valid"`
+		UserName string `json:"user_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", c.name, err)
+	}
+	if !info.Valid {
+		return registry.Permanent(fmt.Errorf("invalid ListenBrainz user token"))
+	}
+	c.logger.Info().Msgf("Connected to ListenBrainz as %s", info.UserName)
+	return nil
+}
+
+// Scrobble reports a track as playing now, and submits it as a listen once
+// it has been played for half its duration or four minutes, whichever comes first.
+func (c *Client) Scrobble(session types.MediaSession, action string) error {
+	if session.Type != "track" {
+		return fmt.Errorf("unsupported media type: %s", session.Type)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := c.getListenState(session)
+
+	if action == "start" && !state.nowPlayingSent {
+		if err := c.submit("playing_now", buildListen(session, 0)); err != nil {
+			return err
+		}
+		state.nowPlayingSent = true
+	}
+
+	if !state.listenSent && isListen(session) {
+		if err := c.submit("single", buildListen(session, state.startedAt.Unix())); err != nil {
+			return err
+		}
+		state.listenSent = true
+		c.logger.Trace().
+			Str("title", session.Title).
+			Str("artist", session.Artist).
+			Msgf("Submitted listen to %s", c.name)
+	}
+	return nil
+}
+
+// SyncHistory imports a single completed track as a listen
+func (c *Client) SyncHistory(session types.MediaSession) error {
+	if session.Type != "track" {
+		return fmt.Errorf("unsupported media type: %s", session.Type)
+	}
+	listenedAt := session.ViewedAt
+	if listenedAt == 0 {
+		listenedAt = time.Now().Unix()
+	}
+	return c.submit("import", buildListen(session, listenedAt))
+}
+
+// Preview returns the listen a completed track would be submitted as
+func (c *Client) Preview(session types.MediaSession, action string) (string, error) {
+	if session.Type != "track" {
+		return "", fmt.Errorf("%w: %s", registry.ErrUnsupported, session.Type)
+	}
+	data, err := json.Marshal(buildListen(session, session.ViewedAt))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal listen: %w", err)
+	}
+	return string(data), nil
+}
+
+// getListenState returns the tracked state of the play of a track, starting a new play when the
+// track has been restarted after a listen was submitted. The caller must hold c.mu.
+func (c *Client) getListenState(session types.MediaSession) *listenState {
+	now := time.Now()
+	// Drop plays that have not been reported for a day
+	for key, state := range c.listens {
+		if now.Sub(state.seenAt) > listenStateTTL {
+			delete(c.listens, key)
+		}
+	}
+
+	key := fmt.Sprintf("%s-%s-%s-%s", session.Source, session.User.ID, session.SessionID, session.Title)
+	state, ok := c.listens[key]
+	if !ok || (state.listenSent && session.State == "playing" && !isListen(session)) {
+		// The play started when it is first seen, minus what was already played of it
+		state = &listenState{
+			startedAt: now.Add(-time.Duration(session.ViewOffset) * time.Millisecond),
+		}
+		c.listens[key] = state
+	}
+	state.seenAt = now
+	return state
+}
+
+func (c *Client) submit(listenType string, listen Listen) error {
+	payload := SubmitRequest{
+		ListenType: listenType,
+		Payload:    []Listen{listen},
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/1/submit-listens", c.config.URL), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("listenbrainz API error %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// isListen reports whether a track has been played long enough to count as a listen
+func isListen(session types.MediaSession) bool {
+	return session.Progress >= 50 || session.ViewOffset >= (4*time.Minute).Milliseconds()
+}
+
+func buildListen(session types.MediaSession, listenedAt int64) Listen {
+	return Listen{
+		ListenedAt: listenedAt,
+		TrackMetadata: TrackMetadata{
+			ArtistName:  session.Artist,
+			TrackName:   session.Title,
+			ReleaseName: session.Album,
+			AdditionalInfo: AdditionalInfo{
+				RecordingMBID:           session.RecordingMBID,
+				TrackMBID:               session.TrackMBID,
+				ReleaseMBID:             session.ReleaseMBID,
+				ArtistMBIDs:             session.ArtistMBIDs,
+				TrackNumber:             session.TrackNum,
+				DurationMs:              session.Duration,
+				SubmissionClient:        "scroblarr",
+				SubmissionClientVersion: version.GetInfo().String(),
+			},
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package listenbrainz
+
+// SubmitRequest represents a request to ListenBrainz's submit-listens API
+type SubmitRequest struct {
+	ListenType string   `json:"listen_type"` // "single", "playing_now" or "import"
+	Payload    []Listen `json:"payload"`
+}
+
+// Listen represents a single listen in ListenBrainz's API
+type Listen struct {
+	ListenedAt    int64         `json:"listened_at,omitempty"`
+	TrackMetadata TrackMetadata `json:"track_metadata"`
+}
+
+// TrackMetadata represents the metadata of a listened track
+type TrackMetadata struct {
+	ArtistName     string         `json:"artist_name"`
+	TrackName      string         `json:"track_name"`
+	ReleaseName    string         `json:"release_name,omitempty"`
+	AdditionalInfo AdditionalInfo `json:"additional_info"`
+}
+
+// AdditionalInfo carries the MusicBrainz IDs and client details of a listen
+type AdditionalInfo struct {
+	RecordingMBID           string   `json:"recording_mbid,omitempty"`
+	TrackMBID               string   `json:"track_mbid,omitempty"`
+	ReleaseMBID             string   `json:"release_mbid,omitempty"`
+	ArtistMBIDs             []string `json:"artist_mbids,omitempty"`
+	TrackNumber             int      `json:"tracknumber,omitempty"`
+	DurationMs              int64    `json:"duration_ms,omitempty"`
+	SubmissionClient        string   `json:"submission_client"`
+	SubmissionClientVersion string   `json:"submission_client_version,omitempty"`
+}
@@ -0,0 +1,186 @@
+package matcher
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"slices"
+	"sort"
+)
+
+// Match is a candidate item with how likely it is the item looked for
+type Match struct {
+	Session types.MediaSession
+	Score   float64 // From 0 to 1
+}
+
+// Rank scores every candidate against want, best first
+func Rank(want types.MediaSession, candidates []types.MediaSession) []Match {
+	matches := make([]Match, 0, len(candidates))
+	for _, candidate := range candidates {
+		matches = append(matches, Match{Session: candidate, Score: Score(want, candidate)})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
+
+// Best returns the candidate with the highest score, if it reaches minScore. It returns none when
+// another item scores as high, as there is no telling which is meant. Copies of the same item,
+// e.g. a movie in two libraries, share an external ID and are not a tie.
+func Best(want types.MediaSession, candidates []types.MediaSession, minScore float64) (types.MediaSession, float64, bool) {
+	ranked := Rank(want, candidates)
+	if len(ranked) == 0 {
+		return types.MediaSession{}, 0, false
+	}
+	best := ranked[0]
+	if best.Score < minScore {
+		return types.MediaSession{}, best.Score, false
+	}
+	for _, match := range ranked[1:] {
+		if match.Score < best.Score {
+			break
+		}
+		if best.Session.IDs.Matches(match.Session.IDs) {
+			continue
+		}
+		return types.MediaSession{}, best.Score, false
+	}
+	return best.Session, best.Score, true
+}
+
+// Score rates from 0 to 1 how likely candidate is the movie, show or episode wanted.
+// A shared external ID is certain and a conflicting one rules the candidate out.
+// Otherwise the titles are compared, with the year allowed to be off by one.
+func Score(want, candidate types.MediaSession) float64 {
+	if want.Type != candidate.Type {
+		return 0
+	}
+	if want.Type == "episode" {
+		return scoreEpisode(want, candidate)
+	}
+	if want.IDs.Matches(candidate.IDs) {
+		return 1
+	}
+	if conflicts(want.IDs, candidate.IDs) {
+		return 0
+	}
+	similarity := titleSimilarity(
+		titles(want.Title, want.OriginalTitle),
+		titles(candidate.Title, candidate.OriginalTitle),
+	)
+	return similarity * yearFactor(want.Year, candidate.Year)
+}
+
+// scoreEpisode compares the shows, then the season and episode numbers, falling back
+// to the episode titles for shows numbering their episodes differently
+func scoreEpisode(want, candidate types.MediaSession) float64 {
+	if want.IDs.Matches(candidate.IDs) {
+		return 1
+	}
+	var show float64
+	switch {
+	case want.ShowIDs.Matches(candidate.ShowIDs):
+		show = 1
+	case conflicts(want.ShowIDs, candidate.ShowIDs):
+		return 0
+	default:
+		show = titleSimilarity(titles(want.ShowTitle), titles(candidate.ShowTitle))
+	}
+	if same := sameEpisode(want, candidate); same > 0 {
+		return show * same
+	}
+	episode := titleSimilarity(titles(want.EpisodeTitle), titles(candidate.EpisodeTitle))
+	if episode < 0.9 {
+		return 0
+	}
+	// Matching by title alone is less certain than by number
+	return show * episode * 0.9
+}
+
+// sameEpisode rates how surely two episodes of a show are the same by their numbers. Servers numbering
+// a show in another episode order still agree on the absolute number, or on the air date of a daily show.
+func sameEpisode(want, candidate types.MediaSession) float64 {
+	switch {
+	case want.SeasonNum == candidate.SeasonNum && want.EpisodeNum == candidate.EpisodeNum:
+		return 1
+	case want.AbsoluteNum != 0 && candidate.AbsoluteNum != 0:
+		if want.AbsoluteNum == candidate.AbsoluteNum {
+			return 1
+		}
+		return 0
+	case want.SeasonNum != candidate.SeasonNum && want.AirDate != "" && want.AirDate == candidate.AirDate:
+		// Episodes of a season can share an air date, so only episodes filed in different seasons match on it
+		return 0.95
+	default:
+		return 0
+	}
+}
+
+// conflicts reports whether both sets have the same kind of external ID with different values
+func conflicts(a, b types.IDs) bool {
+	return (a.IMDB != "" && b.IMDB != "" && a.IMDB != b.IMDB) ||
+		(a.TMDB != "" && b.TMDB != "" && a.TMDB != b.TMDB) ||
+		(a.TVDB != "" && b.TVDB != "" && a.TVDB != b.TVDB)
+}
+
+// yearFactor lowers the score of a year off by one, and rules out years further apart
+func yearFactor(a, b int) float64 {
+	switch {
+	case a == 0 || b == 0:
+		return 0.95
+	case a == b:
+		return 1
+	case a-b == 1 || b-a == 1:
+		return 0.9
+	default:
+		return 0
+	}
+}
+
+// titleSimilarity is the best similarity between any title of one item and any of the other.
+// Titles with different numbers, e.g. "Part 1" and "Part 2" of a movie, are different items.
+func titleSimilarity(a, b []string) float64 {
+	var best float64
+	for _, x := range a {
+		for _, y := range b {
+			if slices.Equal(numbers(x), numbers(y)) {
+				best = max(best, similarity(x, y))
+			}
+		}
+	}
+	return best
+}
+
+// similarity is one minus the edit distance between two strings relative to the longer one
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	x, y := []rune(a), []rune(b)
+	longest := max(len(x), len(y))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(x, y))/float64(longest)
+}
+
+// levenshtein counts the insertions, deletions and substitutions turning a into b
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
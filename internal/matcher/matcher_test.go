@@ -0,0 +1,108 @@
+package matcher
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"testing"
+)
+
+func movie(title string, year int, tmdb string) types.MediaSession {
+	return types.MediaSession{Type: "movie", Title: title, Year: year, IDs: types.IDs{TMDB: tmdb}}
+}
+
+func episode(show string, season, number int) types.MediaSession {
+	return types.MediaSession{Type: "episode", ShowTitle: show, SeasonNum: season, EpisodeNum: number}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		want      types.MediaSession
+		candidate types.MediaSession
+		min, max  float64
+	}{
+		{"shared id", movie("Alien", 1979, "348"), movie("Alien (Director's Cut)", 2003, "348"), 1, 1},
+		{"conflicting id", movie("Alien", 1979, "348"), movie("Alien", 1979, "999"), 0, 0},
+		{"same title and year", movie("The Matrix", 1999, ""), movie("Matrix", 1999, ""), 1, 1},
+		{"year off by one", movie("The Matrix", 1999, ""), movie("The Matrix", 2000, ""), 0.9, 0.9},
+		{"years apart", movie("The Matrix", 1999, ""), movie("The Matrix", 2003, ""), 0, 0},
+		{"different sequel", movie("Harry Potter and the Deathly Hallows Part 1", 2010, ""), movie("Harry Potter and the Deathly Hallows Part 2", 2011, ""), 0, 0},
+		{"other type", movie("Alien", 1979, "348"), types.MediaSession{Type: "show", Title: "Alien", Year: 1979}, 0, 0},
+		{"same episode", episode("Doctor Who", 1, 2), episode("Doctor Who (2005)", 1, 2), 1, 1},
+		{"other episode", episode("Doctor Who", 1, 2), episode("Doctor Who", 1, 3), 0, 0},
+		{
+			"absolute number",
+			types.MediaSession{Type: "episode", ShowTitle: "One Piece", SeasonNum: 2, EpisodeNum: 1, AbsoluteNum: 62},
+			types.MediaSession{Type: "episode", ShowTitle: "One Piece", SeasonNum: 1, EpisodeNum: 62, AbsoluteNum: 62},
+			1, 1,
+		},
+		{
+			"air date across seasons",
+			types.MediaSession{Type: "episode", ShowTitle: "The Daily Show", SeasonNum: 2024, EpisodeNum: 10, AirDate: "2024-01-15"},
+			types.MediaSession{Type: "episode", ShowTitle: "The Daily Show", SeasonNum: 29, EpisodeNum: 5, AirDate: "2024-01-15"},
+			0.95, 0.95,
+		},
+		{
+			"episode title",
+			types.MediaSession{Type: "episode", ShowTitle: "Lost", SeasonNum: 1, EpisodeNum: 1, EpisodeTitle: "Pilot (1)"},
+			types.MediaSession{Type: "episode", ShowTitle: "Lost", SeasonNum: 0, EpisodeNum: 3, EpisodeTitle: "Pilot (1)"},
+			0.9, 0.9,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Score(tt.want, tt.candidate); got < tt.min || got > tt.max {
+				t.Errorf("Score() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBest(t *testing.T) {
+	tests := []struct {
+		name       string
+		want       types.MediaSession
+		candidates []types.MediaSession
+		found      bool
+		tmdb       string
+	}{
+		{"no candidates", movie("Alien", 1979, ""), nil, false, ""},
+		{
+			"best of several",
+			movie("Alien", 1979, ""),
+			[]types.MediaSession{movie("Aliens", 1986, "679"), movie("Alien", 1979, "348")},
+			true, "348",
+		},
+		{
+			"below the minimum score",
+			movie("Alien", 1979, ""),
+			[]types.MediaSession{movie("Alien Resurrection", 1997, "8078")},
+			false, "",
+		},
+		{
+			"tied items",
+			movie("Dune", 0, ""),
+			[]types.MediaSession{movie("Dune", 0, "841"), movie("Dune", 0, "438631")},
+			false, "",
+		},
+		{
+			"copies of one item",
+			movie("Dune", 0, ""),
+			[]types.MediaSession{movie("Dune", 0, "438631"), movie("Dune", 0, "438631")},
+			true, "438631",
+		},
+		{
+			"other part",
+			movie("Harry Potter and the Deathly Hallows Part 1", 0, ""),
+			[]types.MediaSession{movie("Harry Potter and the Deathly Hallows Part 2", 2011, "12445")},
+			false, "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, found := Best(tt.want, tt.candidates, 0.85)
+			if found != tt.found || got.IDs.TMDB != tt.tmdb {
+				t.Errorf("Best() = %q, %v, want %q, %v", got.IDs.TMDB, found, tt.tmdb, tt.found)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package matcher
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// articles are the leading words dropped from titles. Only English ones are dropped, as the articles
+// of other languages are words of their own in English titles, e.g. "Die Hard".
+var articles = []string{"the", "a", "an"}
+
+// folds maps accented Latin letters to their base letters
+var folds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// trailingYear matches a year at the end of a title, e.g. "Doctor Who (2005)"
+var trailingYear = regexp.MustCompile(`\s*\(\d{4}\)$`)
+
+// Normalize folds a title for comparison: lower case, without diacritics, punctuation
+// or a leading article, with "&" spelled out and single spaces
+func Normalize(title string) string {
+	title = trailingYear.ReplaceAllString(strings.TrimSpace(title), "")
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case folds[r] != "":
+			b.WriteString(folds[r])
+		case r == '&':
+			b.WriteString(" and ")
+		case r == '\'' || r == '’':
+			// "Don't" and "Dont" are the same title
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	if len(words) > 1 {
+		for _, article := range articles {
+			if words[0] == article {
+				words = words[1:]
+				break
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// titles returns the distinct normalized titles an item is listed under
+func titles(names ...string) []string {
+	var result []string
+	for _, name := range names {
+		if t := Normalize(name); t != "" && !slices.Contains(result, t) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// numbers returns the numbers in a normalized title, e.g. ["2"] for "toy story 2"
+func numbers(title string) []string {
+	var result []string
+	for _, word := range strings.Fields(title) {
+		if strings.IndexFunc(word, func(r rune) bool { return !unicode.IsDigit(r) }) == -1 {
+			result = append(result, word)
+		}
+	}
+	return result
+}
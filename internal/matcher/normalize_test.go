@@ -0,0 +1,52 @@
+package matcher
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Matrix", "matrix"},
+		{"A Quiet Place", "quiet place"},
+		{"Die Hard", "die hard"},
+		{"La La Land", "la la land"},
+		{"The", "the"},
+		{"Amélie", "amelie"},
+		{"Fast & Furious", "fast and furious"},
+		{"Don't Look Up", "dont look up"},
+		{"Doctor Who (2005)", "doctor who"},
+		{"  Star Wars: Episode IV - A New Hope  ", "star wars episode iv a new hope"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := Normalize(tt.title); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"toy story 2", []string{"2"}},
+		{"harry potter and the deathly hallows part 1", []string{"1"}},
+		{"2001 a space odyssey", []string{"2001"}},
+		{"se7en", nil},
+		{"alien", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := numbers(tt.title); !slices.Equal(got, tt.want) {
+				t.Errorf("numbers(%q) = %v, want %v", tt.title, got, tt.want)
+			}
+		})
+	}
+}
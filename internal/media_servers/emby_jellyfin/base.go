@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/matcher"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/internal/types"
 	"github.com/sirrobot01/scroblarr/pkg/misc"
 	"github.com/sirrobot01/scroblarr/pkg/request"
@@ -14,14 +16,49 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// authFields are the options shared by Emby and Jellyfin
+var authFields = append([]config.Field{
+	{Name: "url", Label: "URL", Kind: config.FieldURL, Required: true, Placeholder: "http://localhost:8096"},
+	{Name: "token", Label: "Token", Kind: config.FieldPassword, Help: "API key, or use a username and password"},
+	{Name: "username", Label: "Username", Kind: config.FieldText},
+	{Name: "password", Label: "Password", Kind: config.FieldPassword},
+}, append(config.RateLimitFields, config.MatchFields...)...)
+
+// capabilities are shared by Emby and Jellyfin
+var capabilities = []config.Capability{
+	config.CapabilitySessions,
+	config.CapabilityHistory,
+	config.CapabilityScrobble,
+	config.CapabilityHistoryWrite,
+	config.CapabilityRatings,
+	config.CapabilityListMirror,
+	config.CapabilityLibrary,
+	config.CapabilityResume,
+	config.CapabilityPlayed,
+	config.CapabilityUnwatch,
+	config.CapabilityPlayCount,
+}
+
+// validateAuth requires a token or a username and password
+func validateAuth(server config.Server) error {
+	if server.Token == "" && (server.Username == "" || server.Password == "") {
+		return registry.Permanent(fmt.Errorf("a token or a username and password is required"))
+	}
+	return nil
+}
+
 // BaseServer implements the BaseServer interface for Jellyfin
 type BaseServer struct {
 	name   string
 	config config.Server
 	logger zerolog.Logger
 	client *request.Client
+	// datePlayedFormat is the time layout of the DatePlayed parameter, which differs between Emby and Jellyfin
+	datePlayedFormat string
 }
 
 // GetName returns the name of the server
@@ -49,8 +86,15 @@ type NowPlayingItem struct {
 	RunTimeTicks      int64             `json:"RunTimeTicks"`
 	ProductionYear    int               `json:"ProductionYear"`
 	IndexNumber       int               `json:"IndexNumber"`
+	IndexNumberEnd    int               `json:"IndexNumberEnd"` // Last episode of a multi-episode file
 	ParentIndexNumber int               `json:"ParentIndexNumber"`
+	OriginalTitle     string            `json:"OriginalTitle"`
+	PremiereDate      string            `json:"PremiereDate"`
 	SeriesName        string            `json:"SeriesName"`
+	SeriesID          string            `json:"SeriesId"`
+	Album             string            `json:"Album"`
+	AlbumArtist       string            `json:"AlbumArtist"`
+	Artists           []string          `json:"Artists"`
 	ProviderIDs       map[string]string `json:"ProviderIds"`
 }
 
@@ -61,6 +105,14 @@ type PlayState struct {
 	IsMuted       bool  `json:"IsMuted"`
 }
 
+// airDate returns the date part of a premiere date such as "2019-05-06T00:00:00.0000000Z"
+func airDate(premiere string) string {
+	if len(premiere) < len("2006-01-02") {
+		return ""
+	}
+	return premiere[:len("2006-01-02")]
+}
+
 func hashString(s string) string {
 	h := fnv.New64a()
 	_, _ = h.Write([]byte(s))
@@ -86,7 +138,7 @@ func (s *BaseServer) GetSessions() ([]types.MediaSession, error) {
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status code %d", resp.StatusCode)
+		return nil, registry.StatusError(s.name, resp.StatusCode)
 	}
 
 	var itemSessions []Session
@@ -111,8 +163,11 @@ func (s *BaseServer) GetSessions() ([]types.MediaSession, error) {
 		}
 
 		mediaType := "movie"
-		if js.NowPlayingItem.Type == "Episode" {
+		switch js.NowPlayingItem.Type {
+		case "Episode":
 			mediaType = "episode"
+		case "Audio":
+			mediaType = "track"
 		}
 
 		// Jellyfin/Emby uses 10000000 ticks per second
@@ -125,27 +180,24 @@ func (s *BaseServer) GetSessions() ([]types.MediaSession, error) {
 		}
 
 		session := types.MediaSession{
-			SessionID:  js.ID,
-			Title:      js.NowPlayingItem.Name,
-			Type:       mediaType,
-			Year:       js.NowPlayingItem.ProductionYear,
-			Duration:   duration,
-			ViewOffset: position,
-			State:      state,
-			Progress:   misc.CalculateProgress(position, duration),
+			SessionID:     js.ID,
+			Title:         js.NowPlayingItem.Name,
+			OriginalTitle: js.NowPlayingItem.OriginalTitle,
+			Type:          mediaType,
+			Year:          js.NowPlayingItem.ProductionYear,
+			Duration:      duration,
+			ViewOffset:    position,
+			State:         state,
+			Progress:      misc.CalculateProgress(position, duration),
 			User: types.User{
 				ID:       js.UserID,
 				Username: js.UserName,
 			},
 		}
 
-		// Extract external IDs
-		if imdbID, ok := js.NowPlayingItem.ProviderIDs["Imdb"]; ok {
-			session.IMDBID = imdbID
-		}
-		if tvdbID, ok := js.NowPlayingItem.ProviderIDs["Tvdb"]; ok {
-			session.TVDBID = tvdbID
-		}
+		session.IDs = providerIDs(js.NowPlayingItem.ProviderIDs)
+		session.IDs.Jellyfin = js.NowPlayingItem.ID
+		session.ShowIDs.Jellyfin = js.NowPlayingItem.SeriesID
 
 		// Handle TV shows
 		if mediaType == "episode" {
@@ -153,6 +205,25 @@ func (s *BaseServer) GetSessions() ([]types.MediaSession, error) {
 			session.EpisodeTitle = js.NowPlayingItem.Name
 			session.SeasonNum = js.NowPlayingItem.ParentIndexNumber
 			session.EpisodeNum = js.NowPlayingItem.IndexNumber
+			session.EpisodeNumEnd = js.NowPlayingItem.IndexNumberEnd
+			session.AirDate = airDate(js.NowPlayingItem.PremiereDate)
+		}
+
+		// Handle music tracks
+		if mediaType == "track" {
+			session.Artist = js.NowPlayingItem.AlbumArtist
+			if len(js.NowPlayingItem.Artists) > 0 {
+				session.Artist = strings.Join(js.NowPlayingItem.Artists, ", ")
+			}
+			session.Album = js.NowPlayingItem.Album
+			session.TrackNum = js.NowPlayingItem.IndexNumber
+			ids := js.NowPlayingItem.ProviderIDs
+			session.RecordingMBID = ids["MusicBrainzRecording"]
+			session.TrackMBID = ids["MusicBrainzTrack"]
+			session.ReleaseMBID = ids["MusicBrainzAlbum"]
+			if artists := ids["MusicBrainzArtist"]; artists != "" {
+				session.ArtistMBIDs = strings.Split(artists, "/")
+			}
 		}
 
 		sessions = append(sessions, session)
@@ -161,10 +232,117 @@ func (s *BaseServer) GetSessions() ([]types.MediaSession, error) {
 	return sessions, nil
 }
 
-// GetWatchHistory returns the watch history from Jellyfin
+// GetWatchHistory returns the played movies and episodes of the configured user
 func (s *BaseServer) GetWatchHistory() ([]types.MediaSession, error) {
-	// This would need to be implemented
-	return []types.MediaSession{}, nil
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default user ID: %w", err)
+	}
+
+	query := url.Values{}
+	query.Add("Recursive", "true")
+	query.Add("IsPlayed", "true")
+	query.Add("IncludeItemTypes", "Movie,Episode")
+	query.Add("Fields", "ProviderIds,PremiereDate")
+	query.Add("SortBy", "DatePlayed")
+	query.Add("SortOrder", "Descending")
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/Users/%s/Items?%s", s.config.URL, userID, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			return
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status code %d", resp.StatusCode)
+	}
+
+	var results struct {
+		Items []struct {
+			NowPlayingItem
+			UserData struct {
+				Played         bool   `json:"Played"`
+				PlayCount      int    `json:"PlayCount"`
+				LastPlayedDate string `json:"LastPlayedDate"`
+			} `json:"UserData"`
+		} `json:"Items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+
+	// Episodes are matched by their show, so add the show's IDs too
+	series := make(map[string]map[string]string)
+	history := make([]types.MediaSession, 0, len(results.Items))
+	for _, item := range results.Items {
+		session := s.itemToMediaSession(item.NowPlayingItem, userID)
+		if item.SeriesID != "" {
+			ids, ok := series[item.SeriesID]
+			if !ok {
+				var show NowPlayingItem
+				if err := s.getJSON(fmt.Sprintf("/Users/%s/Items/%s", userID, item.SeriesID), &show); err != nil {
+					s.logger.Debug().Err(err).Str("show", item.SeriesName).Msg("Failed to get show metadata")
+				}
+				ids = show.ProviderIDs
+				series[item.SeriesID] = ids
+			}
+			session.ShowIDs.Merge(providerIDs(ids))
+		}
+		session.ViewOffset = session.Duration
+		session.State = "stopped"
+		session.Progress = 100
+		session.ViewedAt = misc.ParseISO8601(item.UserData.LastPlayedDate) / 1000
+		session.PlayCount = item.UserData.PlayCount
+		history = append(history, session)
+	}
+
+	s.logger.Debug().
+		Int("count", len(history)).
+		Msgf("Retrieved watch history from %s", s.name)
+	return history, nil
+}
+
+// itemToMediaSession converts a library movie, show or episode of a user
+func (s *BaseServer) itemToMediaSession(item NowPlayingItem, userID string) types.MediaSession {
+	mediaType := "movie"
+	switch item.Type {
+	case "Episode":
+		mediaType = "episode"
+	case "Series":
+		mediaType = "show"
+	}
+	session := types.MediaSession{
+		SessionID:     item.ID,
+		Title:         item.Name,
+		OriginalTitle: item.OriginalTitle,
+		Type:          mediaType,
+		Year:          item.ProductionYear,
+		Duration:      item.RunTimeTicks / 10000,
+		IDs:           providerIDs(item.ProviderIDs),
+		User: types.User{
+			ID:       userID,
+			Username: s.config.Username,
+		},
+	}
+	session.IDs.Jellyfin = item.ID
+	if mediaType == "episode" {
+		session.ShowIDs.Jellyfin = item.SeriesID
+		session.ShowTitle = item.SeriesName
+		session.EpisodeTitle = item.Name
+		session.SeasonNum = item.ParentIndexNumber
+		session.EpisodeNum = item.IndexNumber
+		session.EpisodeNumEnd = item.IndexNumberEnd
+		session.AirDate = airDate(item.PremiereDate)
+	}
+	return session
 }
 
 // GetServerType returns the type of this server
@@ -172,8 +350,26 @@ func (s *BaseServer) GetServerType() string {
 	return "emby"
 }
 
+// SyncHistory marks a completed item as played
 func (s *BaseServer) SyncHistory(session types.MediaSession) error {
-	//TODO implement me
+	itemId, err := s.findItem(session)
+	if err != nil {
+		return fmt.Errorf("failed to find item in %s: %w", s.name, err)
+	}
+	if itemId == "" {
+		return fmt.Errorf("%w in %s library", registry.ErrNotFound, s.name)
+	}
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	if err := s.markAsPlayed(itemId, userID, session.ViewedAt); err != nil {
+		return fmt.Errorf("failed to mark item as played: %w", err)
+	}
+	s.logger.Trace().
+		Str("title", session.Title).
+		Str("item", itemId).
+		Msgf("Marked as played in %s", s.name)
 	return nil
 }
 
@@ -185,7 +381,7 @@ func (s *BaseServer) Scrobble(session types.MediaSession, action string) error {
 	}
 
 	if itemId == "" {
-		return fmt.Errorf("no matching item found in Jellyfin library")
+		return fmt.Errorf("%w in %s library", registry.ErrNotFound, s.name)
 	}
 
 	// Get the user ID if not provided
@@ -197,7 +393,7 @@ func (s *BaseServer) Scrobble(session types.MediaSession, action string) error {
 	// Determine the API endpoint based on the action
 
 	if action == "scrobble" {
-		return s.markAsPlayed(itemId, userID)
+		return s.markAsPlayed(itemId, userID, session.ViewedAt)
 	}
 
 	positionTicks := session.ViewOffset * 10000 // Convert ms to ticks
@@ -262,126 +458,99 @@ func (s *BaseServer) Scrobble(session types.MediaSession, action string) error {
 // findItem looks up a Jellyfin item ID based on external IDs or title/year
 func (s *BaseServer) findItem(session types.MediaSession) (string, error) {
 	// Try to find by external ID first (more reliable)
-	if session.IMDBID != "" {
-		id, err := s.findByExternalID("Imdb", session.IMDBID)
-		if err == nil && id != "" {
-			return id, nil
+	for _, provider := range []struct{ name, id string }{
+		{"Imdb", session.IDs.IMDB},
+		{"Tmdb", session.IDs.TMDB},
+		{"Tvdb", session.IDs.TVDB},
+		{"AniDB", session.IDs.AniDB},
+	} {
+		if provider.id == "" {
+			continue
 		}
-	}
-
-	if session.TVDBID != "" {
-		id, err := s.findByExternalID("Tvdb", session.TVDBID)
+		id, err := s.findByExternalID(session, provider.name, provider.id)
 		if err == nil && id != "" {
 			return id, nil
 		}
 	}
 
-	// If no external IDs or lookup failed, try by title/year
-	var searchQuery string
-	if session.Type == "episode" && session.ShowTitle != "" {
-		// For TV episodes, search by show name, season, and episode
-		searchQuery = fmt.Sprintf("%s/Items?searchTerm=%s&includeItemTypes=Episode&recursive=true",
-			s.config.URL, url.QueryEscape(session.Title))
-	} else {
-		// For movies, search by title and year
-		searchQuery = fmt.Sprintf("%s/Items?searchTerm=%s&includeItemTypes=Movie&recursive=true",
-			s.config.URL, url.QueryEscape(session.Title))
-		if session.Year > 0 {
-			searchQuery += fmt.Sprintf("&years=%d", session.Year)
+	// If no external IDs or lookup failed, search by title and keep the best match.
+	// The year is left to the matcher, which allows it to be off by one.
+	query := url.Values{}
+	query.Set("searchTerm", session.Title)
+	id, err := s.bestMatch(session, query)
+	if id == "" && session.Type == "episode" && session.ShowTitle != "" {
+		// Episodes without a title of their own, such as the later episodes of a multi-episode file,
+		// are found by their numbers
+		if episodeID, episodeErr := s.findEpisode(session); episodeErr == nil && episodeID != "" {
+			return episodeID, nil
 		}
 	}
+	return id, err
+}
 
-	req, err := http.NewRequest("GET", searchQuery, nil)
-	if err != nil {
-		return "", err
-	}
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			return
-		}
-	}(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status code %d", resp.StatusCode)
-	}
-
-	// Parse the search results
-	var searchResults struct {
-		Items []struct {
-			ID                string `json:"Id"`
-			Name              string `json:"Name"`
-			ProductionYear    int    `json:"ProductionYear"`
-			IndexNumber       int    `json:"IndexNumber"`
-			ParentIndexNumber int    `json:"ParentIndexNumber"`
-		} `json:"Items"`
-		TotalRecordCount int `json:"TotalRecordCount"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&searchResults); err != nil {
+// findEpisode looks an episode up among the episodes of its show
+func (s *BaseServer) findEpisode(session types.MediaSession) (string, error) {
+	showID, err := s.findItem(types.MediaSession{Type: "show", Title: session.ShowTitle, IDs: session.ShowIDs})
+	if err != nil || showID == "" {
 		return "", err
 	}
-
-	// For TV episodes, find the specific episode
-	if session.Type == "episode" && session.ShowTitle != "" {
-		for _, item := range searchResults.Items {
-			if item.ParentIndexNumber == session.SeasonNum &&
-				item.IndexNumber == session.EpisodeNum {
-				return item.ID, nil
-			}
-		}
-	} else if len(searchResults.Items) > 0 {
-		// For movies, just take the first match
-		return searchResults.Items[0].ID, nil
-	}
-
-	return "", nil // No matches found
+	query := url.Values{}
+	query.Set("ParentId", showID)
+	return s.bestMatch(session, query)
 }
 
-// findByExternalID looks up an item by external ID (IMDB, TVDB, etc.)
-func (s *BaseServer) findByExternalID(providerName string, providerID string) (string, error) {
-
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/Items?ProviderIds=%s.%s&recursive=true", s.config.URL, providerName, providerID), nil)
-	if err != nil {
-		return "", err
+// bestMatch returns the ID of the item of session's type listed by a query that the matcher
+// finds most likely to be session, or "" if none is listed
+func (s *BaseServer) bestMatch(session types.MediaSession, query url.Values) (string, error) {
+	itemType := "Movie"
+	switch session.Type {
+	case "episode":
+		itemType = "Episode"
+	case "show":
+		itemType = "Series"
+	}
+	query.Set("includeItemTypes", itemType)
+	query.Set("recursive", "true")
+	query.Set("Fields", "ProviderIds,OriginalTitle,PremiereDate")
+	var results struct {
+		Items []NowPlayingItem `json:"Items"`
 	}
-
-	resp, err := s.client.Do(req)
-	if err != nil {
+	if err := s.getJSON("/Items?"+query.Encode(), &results); err != nil {
 		return "", err
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			return
+	candidates := make([]types.MediaSession, 0, len(results.Items))
+	for _, item := range results.Items {
+		candidates = append(candidates, s.itemToMediaSession(item, ""))
+	}
+	minScore := s.config.GetMinConfidence()
+	match, score, ok := matcher.Best(session, candidates, minScore)
+	if !ok {
+		if len(candidates) > 0 {
+			return "", fmt.Errorf("%w, no confident match for %s, best score %.2f is below %.2f or tied", registry.ErrNotFound, session.Title, score, minScore)
 		}
-	}(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status code %d", resp.StatusCode)
+		return "", nil // No matches found
 	}
-
-	var results struct {
-		Items []struct {
-			ID string `json:"Id"`
-		} `json:"Items"`
-		TotalRecordCount int `json:"TotalRecordCount"`
+	if score < 1 {
+		s.logger.Debug().Msgf("Matched %s to %s by title with a score of %.2f", session.Title, match.Title, score)
 	}
+	return match.SessionID, nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
-		return "", err
-	}
+// findByExternalID looks up an item of session's type by external ID (IMDB, TVDB, etc.). Other
+// item types can share the ID, so the items found still go through the matcher.
+func (s *BaseServer) findByExternalID(session types.MediaSession, providerName string, providerID string) (string, error) {
+	query := url.Values{}
+	query.Set("ProviderIds", providerName+"."+providerID)
+	return s.bestMatch(session, query)
+}
 
-	if results.TotalRecordCount > 0 && len(results.Items) > 0 {
-		return results.Items[0].ID, nil
+// providerIDs converts the provider IDs of an item, e.g. {"Imdb": "tt0111161"}
+func providerIDs(providers map[string]string) types.IDs {
+	var ids types.IDs
+	for provider, id := range providers {
+		ids.Set(provider, id)
 	}
-
-	return "", nil
+	return ids
 }
 
 // getDefaultUserID gets the first admin user's ID
@@ -433,9 +602,13 @@ func (s *BaseServer) getDefaultUserID() (string, error) {
 	return "", fmt.Errorf("no valid users found in Jellyfin")
 }
 
-// markAsPlayed marks an item as played for a user
-func (s *BaseServer) markAsPlayed(itemID, userID string) error {
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/Users/%s/PlayedItems/%s", s.config.URL, userID, itemID), nil)
+// markAsPlayed marks an item as played for a user, adding a play at playedAt when it is set
+func (s *BaseServer) markAsPlayed(itemID, userID string, playedAt int64) error {
+	_url := fmt.Sprintf("%s/Users/%s/PlayedItems/%s", s.config.URL, userID, itemID)
+	if playedAt > 0 {
+		_url += "?" + url.Values{"DatePlayed": {time.Unix(playedAt, 0).UTC().Format(s.datePlayedFormat)}}.Encode()
+	}
+	req, err := http.NewRequest("POST", _url, nil)
 	if err != nil {
 		return err
 	}
@@ -479,7 +652,7 @@ func (s *BaseServer) Connect() error {
 		}
 	}(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s API returned status code %d", s.name, resp.StatusCode)
+		return registry.StatusError(s.name, resp.StatusCode)
 	}
 	var info struct {
 		ServerVersion string `json:"Version"`
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/pkg/request"
 	"io"
 	"net/http"
@@ -19,7 +20,7 @@ func getClient(config config.Server, logger zerolog.Logger) (*request.Client, er
 	case "jellyfin":
 		return jellyfinClient(config, logger)
 	default:
-		return nil, fmt.Errorf("unsupported server type: %s", config.Type)
+		return nil, registry.Permanent(fmt.Errorf("unsupported server type: %s", config.Type))
 	}
 }
 
@@ -58,7 +59,7 @@ func jellyfinClient(config config.Server, logger zerolog.Logger) (*request.Clien
 		}(resp.Body)
 
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("jellyfin API returned status code %d", resp.StatusCode)
+			return nil, registry.StatusError(string(config.Type), resp.StatusCode)
 		}
 
 		var authResponse struct {
@@ -82,6 +83,8 @@ func jellyfinClient(config config.Server, logger zerolog.Logger) (*request.Clien
 	client := request.New(
 		request.WithHeaders(headers),
 		request.WithLogger(logger),
+		request.WithRateLimiter(config.RateLimiter()),
+		request.WithWriteRateLimiter(config.WriteRateLimiter()),
 	)
 	return client, nil
 }
@@ -121,7 +124,7 @@ func embyClient(config config.Server, logger zerolog.Logger) (*request.Client, e
 		}(resp.Body)
 
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("jellyfin API returned status code %d", resp.StatusCode)
+			return nil, registry.StatusError(string(config.Type), resp.StatusCode)
 		}
 
 		var authResponse struct {
@@ -145,6 +148,8 @@ func embyClient(config config.Server, logger zerolog.Logger) (*request.Client, e
 	client := request.New(
 		request.WithHeaders(headers),
 		request.WithLogger(logger),
+		request.WithRateLimiter(config.RateLimiter()),
+		request.WithWriteRateLimiter(config.WriteRateLimiter()),
 	)
 	return client, nil
 }
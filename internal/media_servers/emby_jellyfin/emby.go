@@ -3,6 +3,7 @@ package emby_jellyfin
 import (
 	"fmt"
 	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
 )
 
@@ -12,15 +13,30 @@ type Emby struct {
 	BaseServer
 }
 
+func init() {
+	registry.Register(registry.Definition{
+		ServerType: config.ServerType{
+			Name:         config.Emby,
+			Label:        "Emby",
+			Fields:       authFields,
+			Capabilities: capabilities,
+			Validate:     validateAuth,
+		},
+		New: func(name string, cfg config.Server) (registry.Server, error) {
+			return NewEmby(name, cfg)
+		},
+	})
+}
+
 // NewEmby creates a new Emby client
 func NewEmby(name string, config config.Server) (*Emby, error) {
 
 	if config.URL == "" {
-		return nil, fmt.Errorf("missing required URL")
+		return nil, registry.Permanent(fmt.Errorf("missing required URL"))
 	}
 
 	if config.Token == "" && (config.Username == "" || config.Password == "") {
-		return nil, fmt.Errorf("missing authentication information")
+		return nil, registry.Permanent(fmt.Errorf("missing authentication information"))
 	}
 
 	_logger := logger.NewLogger(name)
@@ -36,6 +52,8 @@ func NewEmby(name string, config config.Server) (*Emby, error) {
 			config: config,
 			logger: _logger,
 			client: client,
+			// Emby reads the date played as yyyyMMddHHmmss
+			datePlayedFormat: "20060102150405",
 		},
 	}
 
@@ -0,0 +1,189 @@
+package emby_jellyfin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// favoriteItem is a movie or show with the user's played state
+type favoriteItem struct {
+	NowPlayingItem
+	UserData struct {
+		Played     bool `json:"Played"`
+		IsFavorite bool `json:"IsFavorite"`
+	} `json:"UserData"`
+}
+
+// GetList returns the favorite movies and shows of the configured user. Emby and
+// Jellyfin have a single favorites list, so the name is not used.
+func (s *BaseServer) GetList(name string) ([]types.MediaSession, error) {
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default user ID: %w", err)
+	}
+
+	query := url.Values{}
+	query.Add("Recursive", "true")
+	query.Add("Filters", "IsFavorite")
+	query.Add("IncludeItemTypes", "Movie,Series")
+	query.Add("Fields", "ProviderIds")
+	query.Add("EnableUserData", "true")
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/Users/%s/Items?%s", s.config.URL, userID, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status code %d", resp.StatusCode)
+	}
+
+	var results struct {
+		Items []favoriteItem `json:"Items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+
+	list := make([]types.MediaSession, 0, len(results.Items))
+	for _, item := range results.Items {
+		list = append(list, s.toListItem(item, userID))
+	}
+	return list, nil
+}
+
+// AddToList marks the unwatched library movie or show matching item as a favorite
+func (s *BaseServer) AddToList(name string, item types.MediaSession) (types.MediaSession, bool, error) {
+	if item.Type != "movie" && item.Type != "show" {
+		return types.MediaSession{}, false, fmt.Errorf("unsupported media type: %s", item.Type)
+	}
+	itemID, err := s.findItem(item)
+	if err != nil {
+		return types.MediaSession{}, false, fmt.Errorf("failed to find item in %s: %w", s.name, err)
+	}
+	if itemID == "" {
+		return types.MediaSession{}, false, nil
+	}
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return types.MediaSession{}, false, fmt.Errorf("failed to get default user ID: %w", err)
+	}
+
+	var found favoriteItem
+	if err := s.getJSON(fmt.Sprintf("/Users/%s/Items/%s", userID, itemID), &found); err != nil {
+		return types.MediaSession{}, false, fmt.Errorf("failed to get item %s: %w", itemID, err)
+	}
+	if found.UserData.Played {
+		return types.MediaSession{}, false, nil
+	}
+	if !found.UserData.IsFavorite {
+		if err := s.setFavorite(userID, itemID, true); err != nil {
+			return types.MediaSession{}, false, fmt.Errorf("failed to add %s to favorites: %w", found.Name, err)
+		}
+		s.logger.Debug().Msgf("Added %s to favorites in %s", found.Name, s.name)
+	}
+	return s.toListItem(found, userID), true, nil
+}
+
+// RemoveFromList removes an item returned by GetList from the favorites
+func (s *BaseServer) RemoveFromList(name string, item types.MediaSession) error {
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	if err := s.setFavorite(userID, item.SessionID, false); err != nil {
+		return fmt.Errorf("failed to remove %s from favorites: %w", item.Title, err)
+	}
+	s.logger.Debug().Msgf("Removed %s from favorites in %s", item.Title, s.name)
+	return nil
+}
+
+// toListItem converts a favorite, with a Progress of 100 once it is watched
+func (s *BaseServer) toListItem(item favoriteItem, userID string) types.MediaSession {
+	session := s.itemToMediaSession(item.NowPlayingItem, userID)
+	session.LibraryType = session.Type
+	if item.UserData.Played {
+		session.Progress = 100
+	}
+	return session
+}
+
+// itemsPageSize is how many items a listing returns per request
+const itemsPageSize = 500
+
+// getPages returns the items of a listing, a page at a time
+func getPages[T any](s *BaseServer, path string, query url.Values) ([]T, error) {
+	items := make([]T, 0)
+	for start := 0; ; start += itemsPageSize {
+		page := url.Values{}
+		for key, values := range query {
+			page[key] = values
+		}
+		page.Set("StartIndex", strconv.Itoa(start))
+		page.Set("Limit", strconv.Itoa(itemsPageSize))
+		var results struct {
+			Items            []T `json:"Items"`
+			TotalRecordCount int `json:"TotalRecordCount"`
+		}
+		if err := s.getJSON(path+"?"+page.Encode(), &results); err != nil {
+			return nil, err
+		}
+		items = append(items, results.Items...)
+		if len(results.Items) < itemsPageSize || len(items) >= results.TotalRecordCount {
+			return items, nil
+		}
+	}
+}
+
+// getJSON decodes the response of a GET request into v
+func (s *BaseServer) getJSON(path string, v any) error {
+	req, err := http.NewRequest("GET", s.config.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errItemNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status code %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// setFavorite adds an item to the favorites of a user, or removes it
+func (s *BaseServer) setFavorite(userID, itemID string, favorite bool) error {
+	method := "POST"
+	if !favorite {
+		method = "DELETE"
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/Users/%s/FavoriteItems/%s", s.config.URL, userID, itemID), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API returned error %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -3,20 +3,37 @@ package emby_jellyfin
 import (
 	"fmt"
 	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
+	"time"
 )
 
 type Jellyfin struct {
 	BaseServer
 }
 
+func init() {
+	registry.Register(registry.Definition{
+		ServerType: config.ServerType{
+			Name:         config.Jellyfin,
+			Label:        "Jellyfin",
+			Fields:       authFields,
+			Capabilities: capabilities,
+			Validate:     validateAuth,
+		},
+		New: func(name string, cfg config.Server) (registry.Server, error) {
+			return NewJellyfin(name, cfg)
+		},
+	})
+}
+
 func NewJellyfin(name string, config config.Server) (*Jellyfin, error) {
 	if config.URL == "" {
-		return nil, fmt.Errorf("missing required URL")
+		return nil, registry.Permanent(fmt.Errorf("missing required URL"))
 	}
 
 	if config.Token == "" && (config.Username == "" || config.Password == "") {
-		return nil, fmt.Errorf("missing authentication information")
+		return nil, registry.Permanent(fmt.Errorf("missing authentication information"))
 	}
 
 	_logger := logger.NewLogger(name)
@@ -32,6 +49,8 @@ func NewJellyfin(name string, config config.Server) (*Jellyfin, error) {
 			config: config,
 			logger: _logger,
 			client: client,
+			// Jellyfin reads the date played as an ISO 8601 date
+			datePlayedFormat: time.RFC3339,
 		},
 	}
 
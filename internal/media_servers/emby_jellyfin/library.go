@@ -0,0 +1,133 @@
+package emby_jellyfin
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"github.com/sirrobot01/scroblarr/pkg/misc"
+	"net/url"
+)
+
+// libraryItem is a movie or episode with its streams
+type libraryItem struct {
+	NowPlayingItem
+	DateCreated  string `json:"DateCreated"`
+	MediaStreams []struct {
+		Type           string `json:"Type"` // "Video", "Audio" or "Subtitle"
+		Codec          string `json:"Codec"`
+		Profile        string `json:"Profile"`
+		Height         int    `json:"Height"`
+		Channels       int    `json:"Channels"`
+		IsDefault      bool   `json:"IsDefault"`
+		VideoRange     string `json:"VideoRange"`
+		VideoRangeType string `json:"VideoRangeType"` // Jellyfin only
+	} `json:"MediaStreams"`
+}
+
+// GetLibraries returns the movie and show libraries of the configured user. Emby and Jellyfin
+// do not report when a library changed, so UpdatedAt is when the newest item was added.
+func (s *BaseServer) GetLibraries() ([]types.Library, error) {
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	var views struct {
+		Items []struct {
+			ID             string `json:"Id"`
+			Name           string `json:"Name"`
+			CollectionType string `json:"CollectionType"`
+		} `json:"Items"`
+	}
+	if err := s.getJSON(fmt.Sprintf("/Users/%s/Views", userID), &views); err != nil {
+		return nil, fmt.Errorf("failed to get libraries: %w", err)
+	}
+
+	libraries := make([]types.Library, 0, len(views.Items))
+	for _, view := range views.Items {
+		library := types.Library{ID: view.ID, Name: view.Name}
+		switch view.CollectionType {
+		case "movies":
+			library.Type = "movie"
+		case "tvshows":
+			library.Type = "show"
+		default:
+			continue
+		}
+
+		query := url.Values{}
+		query.Add("ParentId", view.ID)
+		query.Add("Recursive", "true")
+		query.Add("IncludeItemTypes", "Movie,Episode")
+		query.Add("SortBy", "DateCreated")
+		query.Add("SortOrder", "Descending")
+		query.Add("Fields", "DateCreated")
+		query.Add("Limit", "1")
+		var newest struct {
+			Items []libraryItem `json:"Items"`
+		}
+		if err := s.getJSON(fmt.Sprintf("/Users/%s/Items?%s", userID, query.Encode()), &newest); err != nil {
+			return nil, fmt.Errorf("failed to get newest item of %s: %w", view.Name, err)
+		}
+		if len(newest.Items) > 0 {
+			library.UpdatedAt = misc.ParseISO8601(newest.Items[0].DateCreated) / 1000
+		}
+		libraries = append(libraries, library)
+	}
+	return libraries, nil
+}
+
+// GetLibraryItems returns the movies or episodes of a movie or show library
+func (s *BaseServer) GetLibraryItems(library types.Library) ([]types.LibraryItem, error) {
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	query := url.Values{}
+	query.Add("ParentId", library.ID)
+	query.Add("Recursive", "true")
+	query.Add("Fields", "ProviderIds,MediaStreams,DateCreated")
+	switch library.Type {
+	case "movie":
+		query.Add("IncludeItemTypes", "Movie")
+	case "show":
+		query.Add("IncludeItemTypes", "Episode")
+	default:
+		return nil, fmt.Errorf("unsupported library type: %s", library.Type)
+	}
+	var results struct {
+		Items []libraryItem `json:"Items"`
+	}
+	if err := s.getJSON(fmt.Sprintf("/Users/%s/Items?%s", userID, query.Encode()), &results); err != nil {
+		return nil, fmt.Errorf("failed to get items of %s: %w", library.Name, err)
+	}
+
+	items := make([]types.LibraryItem, 0, len(results.Items))
+	for _, item := range results.Items {
+		libraryItem := types.LibraryItem{
+			Session: s.itemToMediaSession(item.NowPlayingItem, userID),
+			AddedAt: misc.ParseISO8601(item.DateCreated) / 1000,
+		}
+		libraryItem.Session.LibraryID = library.ID
+		libraryItem.Session.LibraryName = library.Name
+		libraryItem.Session.LibraryType = library.Type
+
+		var hasVideo, hasAudio bool
+		for _, stream := range item.MediaStreams {
+			switch {
+			case stream.Type == "Video" && !hasVideo:
+				hasVideo = true
+				libraryItem.Media.Resolution = types.ResolutionFromHeight(stream.Height)
+				videoRange := stream.VideoRangeType
+				if videoRange == "" {
+					videoRange = stream.VideoRange
+				}
+				libraryItem.Media.HDR = types.HDRFromVideoRange(videoRange)
+			case stream.Type == "Audio" && (!hasAudio || stream.IsDefault):
+				hasAudio = true
+				libraryItem.Media.Audio = types.AudioFromCodec(stream.Codec, stream.Profile)
+				libraryItem.Media.AudioChannels = types.AudioChannelsFromCount(stream.Channels)
+			}
+		}
+		items = append(items, libraryItem)
+	}
+	return items, nil
+}
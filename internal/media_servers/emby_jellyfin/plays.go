@@ -0,0 +1,50 @@
+package emby_jellyfin
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"time"
+)
+
+// AddPlays adds plays to an item for the configured user, all dated at session.ViewedAt so it becomes the
+// last played date. With no plays only the last played date is set.
+func (s *BaseServer) AddPlays(session types.MediaSession, plays int) error {
+	itemID, err := s.findItem(session)
+	if err != nil {
+		return fmt.Errorf("failed to find item in %s: %w", s.name, err)
+	}
+	if itemID == "" {
+		return fmt.Errorf("%w in %s library", registry.ErrNotFound, s.name)
+	}
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	if plays == 0 {
+		if session.ViewedAt == 0 {
+			return nil
+		}
+		played := time.Unix(session.ViewedAt, 0).UTC().Format(time.RFC3339)
+		if err := s.setUserData(userID, itemID, userData{LastPlayedDate: played}); err != nil {
+			return fmt.Errorf("failed to set last played date: %w", err)
+		}
+		return nil
+	}
+	// Each request with a date played counts as a play
+	playedAt := session.ViewedAt
+	if playedAt == 0 {
+		playedAt = time.Now().Unix()
+	}
+	for range plays {
+		if err := s.markAsPlayed(itemID, userID, playedAt); err != nil {
+			return fmt.Errorf("failed to add a play: %w", err)
+		}
+	}
+	s.logger.Trace().
+		Str("title", session.Title).
+		Str("item", itemID).
+		Int("plays", plays).
+		Msgf("Added plays in %s", s.name)
+	return nil
+}
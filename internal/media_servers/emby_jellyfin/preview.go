@@ -0,0 +1,22 @@
+package emby_jellyfin
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// Preview reports the library item a write for session would change, without changing it
+func (s *BaseServer) Preview(session types.MediaSession, action string) (string, error) {
+	if session.Type != "movie" && session.Type != "episode" && session.Type != "show" {
+		return "", fmt.Errorf("%w: %s", registry.ErrUnsupported, session.Type)
+	}
+	itemID, err := s.findItem(session)
+	if err != nil {
+		return "", fmt.Errorf("failed to find item in %s: %w", s.name, err)
+	}
+	if itemID == "" {
+		return "", fmt.Errorf("%w in %s library", registry.ErrNotFound, s.name)
+	}
+	return fmt.Sprintf("%s item %s", action, itemID), nil
+}
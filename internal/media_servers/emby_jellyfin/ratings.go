@@ -0,0 +1,144 @@
+package emby_jellyfin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ratingScale is the maximum UserData.Rating
+const ratingScale = 10
+
+// Likes are converted to ratings, clients only offering thumbs up or down
+const (
+	likeRating    = 10
+	dislikeRating = 1
+	likeThreshold = 6 // Ratings from this value count as a like
+)
+
+// userData is the per user state of an item that ratings, resume positions and play dates are read from and written to
+type userData struct {
+	Rating                float64 `json:"Rating,omitempty"`
+	Likes                 *bool   `json:"Likes,omitempty"`
+	PlaybackPositionTicks int64   `json:"PlaybackPositionTicks,omitempty"`
+	LastPlayedDate        string  `json:"LastPlayedDate,omitempty"`
+}
+
+// value returns the rating on the 1-10 scale, falling back to likes
+func (d userData) value() int {
+	if rating := types.RatingFromScale(d.Rating, ratingScale); rating > 0 {
+		return rating
+	}
+	if d.Likes == nil {
+		return 0
+	}
+	if *d.Likes {
+		return likeRating
+	}
+	return dislikeRating
+}
+
+// ratedItem is an item listed with the user's data
+type ratedItem struct {
+	NowPlayingItem
+	UserData userData `json:"UserData"`
+}
+
+// GetRatings returns the rated movies and episodes of the configured user. Only liked, disliked
+// and favorite items are read, which includes every rating Scroblarr writes since those set likes too.
+// Emby and Jellyfin do not record when an item was rated, so RatedAt is 0.
+func (s *BaseServer) GetRatings() ([]types.Rating, error) {
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default user ID: %w", err)
+	}
+
+	ratings := make([]types.Rating, 0)
+	seen := make(map[string]bool)
+	// Filters are combined with AND, so likes and dislikes are listed separately
+	for _, filter := range []string{"IsFavoriteOrLikes", "Dislikes"} {
+		query := url.Values{}
+		query.Add("Recursive", "true")
+		query.Add("IncludeItemTypes", "Movie,Episode")
+		query.Add("Fields", "ProviderIds")
+		query.Add("EnableUserData", "true")
+		query.Add("Filters", filter)
+		items, err := getPages[ratedItem](s, fmt.Sprintf("/Users/%s/Items", userID), query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rated items: %w", err)
+		}
+		for _, item := range items {
+			value := item.UserData.value()
+			if value == 0 || seen[item.ID] {
+				continue
+			}
+			seen[item.ID] = true
+			ratings = append(ratings, types.Rating{
+				Session: s.itemToMediaSession(item.NowPlayingItem, userID),
+				Value:   value,
+			})
+		}
+	}
+
+	s.logger.Debug().
+		Int("count", len(ratings)).
+		Msgf("Retrieved ratings from %s", s.name)
+	return ratings, nil
+}
+
+// SetRating rates an item for the configured user, as a rating and as a like
+func (s *BaseServer) SetRating(rating types.Rating) error {
+	itemID, err := s.findItem(rating.Session)
+	if err != nil {
+		return fmt.Errorf("failed to find item in %s: %w", s.name, err)
+	}
+	if itemID == "" {
+		return fmt.Errorf("%w in %s library", registry.ErrNotFound, s.name)
+	}
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return fmt.Errorf("failed to get default user ID: %w", err)
+	}
+
+	likes := rating.Value >= likeThreshold
+	if err := s.setUserData(userID, itemID, userData{
+		Rating: rating.Scaled(ratingScale),
+		Likes:  &likes,
+	}); err != nil {
+		return err
+	}
+	s.logger.Trace().
+		Str("title", rating.Session.Title).
+		Int("rating", rating.Value).
+		Msgf("Rated in %s", s.name)
+	return nil
+}
+
+// setUserData updates the fields of an item's user data that are set in data
+func (s *BaseServer) setUserData(userID, itemID string, data userData) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user data: %w", err)
+	}
+	_url := fmt.Sprintf("%s/Users/%s/Items/%s/UserData", s.config.URL, userID, itemID)
+	req, err := http.NewRequest("POST", _url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API returned error %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package emby_jellyfin
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// resumeTolerance is how far apart, in ticks, two resume positions can be and still count as the same
+const resumeTolerance = 5 * 10000000
+
+// SetResumePosition sets where the configured user left off an item to the position of the session,
+// through the user data rather than a playback report, so the item is not marked played. An item
+// already resuming there is left alone.
+func (s *BaseServer) SetResumePosition(session types.MediaSession) error {
+	itemID, err := s.findItem(session)
+	if err != nil {
+		return fmt.Errorf("failed to find item in %s: %w", s.name, err)
+	}
+	if itemID == "" {
+		return fmt.Errorf("%w in %s library", registry.ErrNotFound, s.name)
+	}
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	var item struct {
+		UserData userData `json:"UserData"`
+	}
+	if err := s.getJSON(fmt.Sprintf("/Users/%s/Items/%s", userID, itemID), &item); err != nil {
+		return fmt.Errorf("failed to get resume position: %w", err)
+	}
+	ticks := session.ViewOffset * 10000 // Convert ms to ticks
+	if diff := item.UserData.PlaybackPositionTicks - ticks; diff > -resumeTolerance && diff < resumeTolerance {
+		return nil
+	}
+	if err := s.setUserData(userID, itemID, userData{PlaybackPositionTicks: ticks}); err != nil {
+		return fmt.Errorf("failed to set resume position: %w", err)
+	}
+	s.logger.Trace().
+		Str("title", session.Title).
+		Str("item", itemID).
+		Int64("position", session.ViewOffset).
+		Msgf("Set resume position in %s", s.name)
+	return nil
+}
@@ -0,0 +1,76 @@
+package emby_jellyfin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+)
+
+// errItemNotFound is returned for items no longer in the library
+var errItemNotFound = errors.New("item not found")
+
+// GetPlayed returns the watched movies and episodes of the configured user
+func (s *BaseServer) GetPlayed() ([]types.MediaSession, error) {
+	return s.GetWatchHistory()
+}
+
+// IsPlayed reports whether an item listed by GetPlayed is still watched, and still in the library
+func (s *BaseServer) IsPlayed(session types.MediaSession) (bool, bool, error) {
+	if session.IDs.Jellyfin == "" {
+		return false, false, fmt.Errorf("%s has no %s item ID", session.Title, s.name)
+	}
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	var item struct {
+		UserData struct {
+			Played bool `json:"Played"`
+		} `json:"UserData"`
+	}
+	err = s.getJSON(fmt.Sprintf("/Users/%s/Items/%s", userID, session.IDs.Jellyfin), &item)
+	if errors.Is(err, errItemNotFound) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return item.UserData.Played, true, nil
+}
+
+// MarkUnwatched marks an item unplayed for the configured user
+func (s *BaseServer) MarkUnwatched(session types.MediaSession) error {
+	itemID, err := s.findItem(session)
+	if err != nil {
+		return fmt.Errorf("failed to find item in %s: %w", s.name, err)
+	}
+	if itemID == "" {
+		return fmt.Errorf("%w in %s library", registry.ErrNotFound, s.name)
+	}
+	userID, err := s.getDefaultUserID()
+	if err != nil {
+		return fmt.Errorf("failed to get default user ID: %w", err)
+	}
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/Users/%s/PlayedItems/%s", s.config.URL, userID, itemID), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API returned error %d: %s", resp.StatusCode, string(body))
+	}
+	s.logger.Trace().
+		Str("title", session.Title).
+		Str("item", itemID).
+		Msgf("Marked unplayed in %s", s.name)
+	return nil
+}
@@ -0,0 +1,213 @@
+package plex
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/matcher"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// itemsPageSize is how many items a library listing returns per request
+const itemsPageSize = 200
+
+// getItems returns the items listed by a library endpoint, a page at a time. The path may hold
+// filters, which Plex expects unescaped, e.g. "userRating>>=0".
+func (p *Plex) getItems(path string, query url.Values) ([]Metadata, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	items := make([]Metadata, 0)
+	for start := 0; ; start += itemsPageSize {
+		page := url.Values{}
+		for key, values := range query {
+			page[key] = values
+		}
+		page.Set("X-Plex-Container-Start", strconv.Itoa(start))
+		page.Set("X-Plex-Container-Size", strconv.Itoa(itemsPageSize))
+		req, err := http.NewRequest("GET", p.config.URL+path+separator+page.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+		}
+		var container Session
+		err = json.NewDecoder(resp.Body).Decode(&container)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		items = append(items, container.MediaContainer.Metadata...)
+		// Endpoints that do not page return everything at once
+		total := container.MediaContainer.TotalSize
+		if len(container.MediaContainer.Metadata) != itemsPageSize || (total > 0 && len(items) >= total) {
+			return items, nil
+		}
+	}
+}
+
+// GetList returns the items of the named collection in the movie and show libraries
+func (p *Plex) GetList(name string) ([]types.MediaSession, error) {
+	list := make([]types.MediaSession, 0)
+	for _, library := range p.libraries {
+		if library.Type != "movie" && library.Type != "show" {
+			continue
+		}
+		collections, err := p.getItems(fmt.Sprintf("/library/sections/%s/collections", library.ID), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get collections of %s: %w", library.Name, err)
+		}
+		for _, collection := range collections {
+			if !strings.EqualFold(collection.Title, name) {
+				continue
+			}
+			query := url.Values{}
+			query.Set("includeGuids", "1")
+			items, err := p.getItems(fmt.Sprintf("/library/collections/%s/children", collection.RatingKey), query)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get collection %s: %w", name, err)
+			}
+			for _, item := range items {
+				list = append(list, p.toListItem(item, library.ID))
+			}
+		}
+	}
+	return list, nil
+}
+
+// AddToList adds the unwatched library movie or show matching item to the named collection
+func (p *Plex) AddToList(name string, item types.MediaSession) (types.MediaSession, bool, error) {
+	if item.Type != "movie" && item.Type != "show" {
+		return types.MediaSession{}, false, fmt.Errorf("unsupported media type: %s", item.Type)
+	}
+	for _, library := range p.libraries {
+		if library.Type != item.Type {
+			continue
+		}
+		match, ok, err := p.findInSection(library.ID, item)
+		if err != nil {
+			return types.MediaSession{}, false, fmt.Errorf("failed to search %s: %w", library.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		// Search results do not list every collection of an item
+		full, err := p.getMetadata(match.RatingKey)
+		if err != nil {
+			return types.MediaSession{}, false, fmt.Errorf("failed to get %s: %w", match.Title, err)
+		}
+		if isWatched(full) {
+			return types.MediaSession{}, false, nil
+		}
+
+		tags := make([]string, 0, len(full.Collection)+1)
+		for _, tag := range full.Collection {
+			if strings.EqualFold(tag.Tag, name) {
+				return p.toListItem(full, library.ID), true, nil
+			}
+			tags = append(tags, tag.Tag)
+		}
+		query := url.Values{}
+		for i, tag := range append(tags, name) {
+			query.Set(fmt.Sprintf("collection[%d].tag.tag", i), tag)
+		}
+		query.Set("collection.locked", "1")
+		if err := p.editItem(library.ID, item.Type, full.RatingKey, query); err != nil {
+			return types.MediaSession{}, false, fmt.Errorf("failed to add %s to %s: %w", full.Title, name, err)
+		}
+		p.logger.Debug().Msgf("Added %s to collection %s", full.Title, name)
+		return p.toListItem(full, library.ID), true, nil
+	}
+	return types.MediaSession{}, false, nil
+}
+
+// RemoveFromList removes an item returned by GetList from the named collection
+func (p *Plex) RemoveFromList(name string, item types.MediaSession) error {
+	query := url.Values{}
+	query.Set("collection[].tag.tag-", name)
+	if err := p.editItem(item.LibraryID, item.Type, item.SessionID, query); err != nil {
+		return fmt.Errorf("failed to remove %s from %s: %w", item.Title, name, err)
+	}
+	p.logger.Debug().Msgf("Removed %s from collection %s", item.Title, name)
+	return nil
+}
+
+// findInSection searches a library for a movie or show, preferring a match on an external ID.
+// Title matches below the minimum confidence are not reported.
+func (p *Plex) findInSection(sectionID string, item types.MediaSession) (Metadata, bool, error) {
+	query := url.Values{}
+	query.Set("type", getMediaType(item.Type))
+	query.Set("title", item.Title)
+	query.Set("includeGuids", "1")
+	results, err := p.getItems(fmt.Sprintf("/library/sections/%s/all", sectionID), query)
+	if err != nil {
+		return Metadata{}, false, err
+	}
+
+	candidates := make([]types.MediaSession, len(results))
+	for i, result := range results {
+		result.User.Title = ""
+		candidates[i] = p.plexItemsToMediaSessions([]Metadata{result})[0]
+	}
+	match, _, ok := matcher.Best(item, candidates, p.config.GetMinConfidence())
+	if !ok {
+		return Metadata{}, false, nil
+	}
+	for _, result := range results {
+		if result.RatingKey == match.SessionID {
+			return result, true, nil
+		}
+	}
+	return Metadata{}, false, nil
+}
+
+// editItem changes the tags of a movie or show
+func (p *Plex) editItem(sectionID, mediaType, ratingKey string, query url.Values) error {
+	query.Set("type", getMediaType(mediaType))
+	query.Set("id", ratingKey)
+	_url := fmt.Sprintf("%s/library/sections/%s/all?%s", p.config.URL, sectionID, query.Encode())
+	req, err := http.NewRequest("PUT", _url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// toListItem converts a collection item, with a Progress of 100 once it is watched
+func (p *Plex) toListItem(item Metadata, sectionID string) types.MediaSession {
+	item.User.Title = ""
+	session := p.plexItemsToMediaSessions([]Metadata{item})[0]
+	session.LibraryID = sectionID
+	session.LibraryType = item.Type
+	session.Progress = 0
+	if isWatched(item) {
+		session.Progress = 100
+	}
+	return session
+}
+
+// isWatched reports whether a movie has been played, or every episode of a show
+func isWatched(item Metadata) bool {
+	if item.Type == "show" {
+		return item.LeafCount > 0 && item.ViewedLeafCount >= item.LeafCount
+	}
+	return item.ViewCount > 0
+}
@@ -0,0 +1,36 @@
+package plex
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// multiEpisode matches the episodes of a file named like "S01E01-E02" or "s01e01e02e03"
+var multiEpisode = regexp.MustCompile(`(?i)s(\d{1,3})e(\d{1,4})((?:-?e\d{1,4})+)`)
+
+// lastEpisode returns the last episode of a file spanning several episodes, or 0. Plex lists each
+// episode of such a file as its own item, so only the first one is counted as the whole file.
+func lastEpisode(item Metadata) int {
+	for _, media := range item.Media {
+		for _, part := range media.Part {
+			name := path.Base(strings.ReplaceAll(part.File, `\`, "/"))
+			match := multiEpisode.FindStringSubmatch(name)
+			if match == nil {
+				continue
+			}
+			season, _ := strconv.Atoi(match[1])
+			first, _ := strconv.Atoi(match[2])
+			if season != item.ParentIndex || first != item.Index {
+				continue
+			}
+			numbers := strings.FieldsFunc(strings.ToLower(match[3]), func(r rune) bool { return r == '-' || r == 'e' })
+			last, _ := strconv.Atoi(numbers[len(numbers)-1])
+			if last > first {
+				return last
+			}
+		}
+	}
+	return 0
+}
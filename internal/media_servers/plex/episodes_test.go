@@ -0,0 +1,41 @@
+package plex
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLastEpisode(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		season  int
+		episode int
+		want    int
+	}{
+		{"single episode", "/tv/Show/Season 01/Show - S01E01.mkv", 1, 1, 0},
+		{"two episodes", "/tv/Show/Season 01/Show - S01E01-E02.mkv", 1, 1, 2},
+		{"without dash", "/tv/Show/Season 01/show.s01e03e04e05.mkv", 1, 3, 5},
+		{"windows path", `D:\TV\Show\Season 02\Show - S02E09-E10.mkv`, 2, 9, 10},
+		{"second item of the file", "/tv/Show/Season 01/Show - S01E01-E02.mkv", 1, 2, 0},
+		{"other season", "/tv/Show/Season 01/Show - S01E01-E02.mkv", 2, 1, 0},
+		{"folder name only", "/tv/Show S01E01-E02/Show.mkv", 1, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var item Metadata
+			data := map[string]any{
+				"parentIndex": tt.season,
+				"index":       tt.episode,
+				"Media":       []any{map[string]any{"Part": []any{map[string]any{"file": tt.file}}}},
+			}
+			raw, _ := json.Marshal(data)
+			if err := json.Unmarshal(raw, &item); err != nil {
+				t.Fatal(err)
+			}
+			if got := lastEpisode(item); got != tt.want {
+				t.Errorf("lastEpisode(%q) = %d, want %d", tt.file, got, tt.want)
+			}
+		})
+	}
+}
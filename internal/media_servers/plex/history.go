@@ -0,0 +1,190 @@
+package plex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type accountsSchema struct {
+	MediaContainer struct {
+		Account []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"Account"`
+	} `json:"MediaContainer"`
+}
+
+// getAccounts returns the names of the server's accounts by ID
+func (p *Plex) getAccounts() (map[int]string, error) {
+	accounts := make(map[int]string)
+	req, err := http.NewRequest("GET", p.config.URL+"/accounts", nil)
+	if err != nil {
+		return accounts, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return accounts, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return accounts, fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+	}
+
+	var schema accountsSchema
+	if err := json.NewDecoder(resp.Body).Decode(&schema); err != nil {
+		return accounts, err
+	}
+	for _, account := range schema.MediaContainer.Account {
+		accounts[account.ID] = account.Name
+	}
+	return accounts, nil
+}
+
+// errItemNotFound is returned for items no longer in the library
+var errItemNotFound = errors.New("item not found")
+
+// getMetadata returns the full metadata of an item, including its external IDs
+func (p *Plex) getMetadata(ratingKey string) (Metadata, error) {
+	_url := fmt.Sprintf("%s/library/metadata/%s?includeGuids=1", p.config.URL, ratingKey)
+	req, err := http.NewRequest("GET", _url, nil)
+	if err != nil {
+		return Metadata{}, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Metadata{}, errItemNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Metadata{}, fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+	}
+
+	var container Session
+	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
+		return Metadata{}, err
+	}
+	if len(container.MediaContainer.Metadata) == 0 {
+		return Metadata{}, fmt.Errorf("no metadata found for %s", ratingKey)
+	}
+	return container.MediaContainer.Metadata[0], nil
+}
+
+// metadataBatchSize is how many items are fetched per metadata request
+const metadataBatchSize = 50
+
+// getMetadataBatch returns the full metadata of items by rating key, a batch per request. Items no
+// longer in the library are left out.
+func (p *Plex) getMetadataBatch(ratingKeys []string) map[string]Metadata {
+	metadata := make(map[string]Metadata, len(ratingKeys))
+	for start := 0; start < len(ratingKeys); start += metadataBatchSize {
+		batch := ratingKeys[start:min(start+metadataBatchSize, len(ratingKeys))]
+		query := url.Values{}
+		query.Set("includeGuids", "1")
+		items, err := p.getItems("/library/metadata/"+strings.Join(batch, ","), query)
+		if err != nil {
+			p.logger.Debug().Err(err).Int("count", len(batch)).Msg("Failed to get item metadata")
+			continue
+		}
+		for _, item := range items {
+			metadata[item.RatingKey] = item
+		}
+	}
+	return metadata
+}
+
+// GetWatchHistory returns the watch history from Plex
+func (p *Plex) GetWatchHistory() ([]types.MediaSession, error) {
+	query := url.Values{}
+	query.Set("sort", "viewedAt:desc")
+	return p.getHistory("", query)
+}
+
+// GetWatchHistorySince returns the plays at or after since, filtered by Plex
+func (p *Plex) GetWatchHistorySince(since time.Time) ([]types.MediaSession, error) {
+	query := url.Values{}
+	query.Set("sort", "viewedAt:desc")
+	return p.getHistory(fmt.Sprintf("viewedAt>=%d", since.Unix()), query)
+}
+
+// getHistory returns the plays of the history matching a filter and query, with the IDs of their items
+func (p *Plex) getHistory(filter string, query url.Values) ([]types.MediaSession, error) {
+	accounts, err := p.getAccounts()
+	if err != nil {
+		p.logger.Debug().Err(err).Msg("Failed to get accounts, history will have no usernames")
+	}
+
+	path := "/status/sessions/history/all"
+	if filter != "" {
+		path += "?" + filter
+	}
+	plays, err := p.getItems(path, query)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Plex history: %w", err)
+	}
+
+	// History entries only reference the item, so fetch the items for their IDs
+	keys := make([]string, 0, len(plays))
+	seen := make(map[string]bool)
+	for _, play := range plays {
+		if !seen[play.RatingKey] {
+			seen[play.RatingKey] = true
+			keys = append(keys, play.RatingKey)
+		}
+	}
+	metadata := p.getMetadataBatch(keys)
+
+	items := make([]Metadata, 0, len(plays))
+	for _, play := range plays {
+		full, ok := metadata[play.RatingKey]
+		if !ok {
+			// The item may have been removed from the library since
+			full = play
+		}
+		full.ViewedAt = play.ViewedAt
+		full.ViewOffset = full.Duration
+		full.Player.State = "stopped"
+		full.User.ID = strconv.Itoa(play.AccountId)
+		full.User.Title = accounts[play.AccountId]
+		items = append(items, full)
+	}
+
+	history := p.plexItemsToMediaSessions(items)
+
+	// Episodes are matched by their show, so add the show's IDs too
+	showKeys := make([]string, 0)
+	for _, item := range metadata {
+		if item.GrandparentKey != "" && !seen[item.GrandparentKey] {
+			seen[item.GrandparentKey] = true
+			showKeys = append(showKeys, item.GrandparentKey)
+		}
+	}
+	shows := p.getMetadataBatch(showKeys)
+	for i := range history {
+		if history[i].Type != "episode" {
+			continue
+		}
+		show, ok := shows[metadata[history[i].SessionID].GrandparentKey]
+		if !ok {
+			continue
+		}
+		showIDs, _ := guidIDs(show)
+		history[i].ShowIDs.Merge(showIDs)
+	}
+
+	p.logger.Debug().
+		Int("count", len(history)).
+		Msg("Retrieved watch history from Plex")
+	return history, nil
+}
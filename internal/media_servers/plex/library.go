@@ -2,17 +2,21 @@ package plex
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/internal/types"
 	"net/http"
+	"net/url"
 )
 
 type librarySchema struct {
 	MediaContainer struct {
 		Size      int `json:"size"`
 		Directory []struct {
-			Key   string `json:"key"`
-			Type  string `json:"type"`
-			Title string `json:"title"`
+			Key       string `json:"key"`
+			Type      string `json:"type"`
+			Title     string `json:"title"`
+			UpdatedAt int64  `json:"updatedAt"`
 		} `json:"Directory"`
 	} `json:"MediaContainer"`
 }
@@ -27,6 +31,10 @@ func (p *Plex) getLibraries() ([]types.Library, error) {
 	if err != nil {
 		return libraries, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return libraries, registry.StatusError("plex", resp.StatusCode)
+	}
 
 	var schema librarySchema
 	if err := json.NewDecoder(resp.Body).Decode(&schema); err != nil {
@@ -36,11 +44,107 @@ func (p *Plex) getLibraries() ([]types.Library, error) {
 
 	for _, dir := range schema.MediaContainer.Directory {
 		libraries = append(libraries, types.Library{
-			ID:   dir.Key,
-			Type: dir.Type,
-			Name: dir.Title,
+			ID:        dir.Key,
+			Type:      dir.Type,
+			Name:      dir.Title,
+			UpdatedAt: dir.UpdatedAt,
 		})
 	}
 
 	return libraries, nil
 }
+
+// GetLibraries returns the libraries of the server, with when they last changed
+func (p *Plex) GetLibraries() ([]types.Library, error) {
+	libraries, err := p.getLibraries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get libraries: %w", err)
+	}
+	return libraries, nil
+}
+
+// GetLibraryItems returns the movies or episodes of a movie or show library
+func (p *Plex) GetLibraryItems(library types.Library) ([]types.LibraryItem, error) {
+	// Plex type codes, 1 is a movie and 4 an episode
+	query := url.Values{}
+	switch library.Type {
+	case "movie":
+		query.Set("type", "1")
+	case "show":
+		query.Set("type", "4")
+	default:
+		return nil, fmt.Errorf("unsupported library type: %s", library.Type)
+	}
+	query.Set("includeGuids", "1")
+	items, err := p.getItems(fmt.Sprintf("/library/sections/%s/all", library.ID), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get items of %s: %w", library.Name, err)
+	}
+
+	hdr := p.getHDR(library, query)
+
+	libraryItems := make([]types.LibraryItem, 0, len(items))
+	for _, item := range items {
+		item.User.Title = ""
+		libraryItem := types.LibraryItem{
+			Session: p.plexItemsToMediaSessions([]Metadata{item})[0],
+			AddedAt: item.AddedAt,
+		}
+		libraryItem.Session.LibraryID = library.ID
+		libraryItem.Session.LibraryName = library.Name
+		libraryItem.Session.LibraryType = library.Type
+		// The first version is the one Plex plays by default
+		if len(item.Media) > 0 {
+			media := item.Media[0]
+			libraryItem.Media = types.MediaInfo{
+				Resolution:    types.ResolutionFromHeight(media.Height),
+				Audio:         types.AudioFromCodec(media.AudioCodec, media.AudioProfile),
+				AudioChannels: types.AudioChannelsFromCount(media.AudioChannels),
+				HDR:           hdr[item.RatingKey],
+			}
+		}
+		libraryItems = append(libraryItems, libraryItem)
+	}
+	return libraryItems, nil
+}
+
+// getHDR returns the HDR format of a library's HDR items by rating key. Listings have no streams, so
+// only the items Plex filters as HDR are read in full.
+func (p *Plex) getHDR(library types.Library, query url.Values) map[string]string {
+	hdr := make(map[string]string)
+	items, err := p.getItems(fmt.Sprintf("/library/sections/%s/all?hdr=1", library.ID), query)
+	if err != nil {
+		p.logger.Debug().Err(err).Msgf("Failed to get HDR items of %s, leaving HDR out", library.Name)
+		return hdr
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.RatingKey)
+	}
+	for key, item := range p.getMetadataBatch(keys) {
+		if len(item.Media) == 0 || len(item.Media[0].Part) == 0 {
+			continue
+		}
+		for _, stream := range item.Media[0].Part[0].Stream {
+			if stream.StreamType == 1 {
+				hdr[key] = hdrFromStream(stream)
+				break
+			}
+		}
+	}
+	return hdr
+}
+
+// hdrFromStream returns the HDR format of a video stream, or "" for SDR
+func hdrFromStream(stream Stream) string {
+	switch {
+	case stream.DOVIPresent:
+		return "dolby_vision"
+	case stream.ColorTrc == "smpte2084":
+		return "hdr10"
+	case stream.ColorTrc == "arib-std-b67":
+		return "hlg"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,29 @@
+package plex
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// AddPlays marks the matching item watched as many times as plays. Plex dates each play when it is
+// added and has no way to set another date, so a last played date alone is not copied.
+func (p *Plex) AddPlays(session types.MediaSession, plays int) error {
+	if plays == 0 {
+		return fmt.Errorf("%w: Plex cannot set a last played date", registry.ErrUnsupported)
+	}
+	item, err := p.find(session)
+	if err != nil {
+		return err
+	}
+	for range plays {
+		if err := p.markAsPlayed(item.SessionID); err != nil {
+			return fmt.Errorf("failed to add a play to %s: %w", item.Title, err)
+		}
+	}
+	p.logger.Trace().
+		Str("title", session.Title).
+		Int("plays", plays).
+		Msgf("Added plays in %s", p.name)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/internal/types"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
 	"github.com/sirrobot01/scroblarr/pkg/misc"
@@ -26,11 +27,36 @@ type Plex struct {
 // Session represents a session in Plex
 type Session struct {
 	MediaContainer struct {
-		Size     int        `json:"size"`
-		Metadata []Metadata `json:"Metadata"`
+		Size      int        `json:"size"`
+		TotalSize int        `json:"totalSize"` // Set on paged listings
+		Metadata  []Metadata `json:"Metadata"`
 	} `json:"MediaContainer"`
 }
 
+// Tag is a collection, genre or other tag of an item
+type Tag struct {
+	Tag string `json:"tag"`
+}
+
+// Media is a version of an item, as listed in the library
+type Media struct {
+	Height        int    `json:"height"`
+	AudioChannels int    `json:"audioChannels"`
+	AudioCodec    string `json:"audioCodec"`
+	AudioProfile  string `json:"audioProfile"`
+	Part          []struct {
+		File   string   `json:"file"`
+		Stream []Stream `json:"Stream"` // Only in the metadata of an item, not in listings
+	} `json:"Part"`
+}
+
+// Stream is a video, audio or subtitle stream of a media part
+type Stream struct {
+	StreamType  int    `json:"streamType"` // 1 is video
+	ColorTrc    string `json:"colorTrc"`   // Transfer characteristics, e.g. "smpte2084" for HDR10
+	DOVIPresent bool   `json:"DOVIPresent"`
+}
+
 // Metadata represents a media item in Plex
 type Metadata struct {
 	RatingKey        string `json:"ratingKey"`
@@ -41,40 +67,96 @@ type Metadata struct {
 	Duration         int64  `json:"duration"`
 	ViewOffset       int64  `json:"viewOffset"`
 	GrandparentTitle string `json:"grandparentTitle"`
+	GrandparentKey   string `json:"grandparentRatingKey"`
+	ParentTitle      string `json:"parentTitle"`
+	OriginalTitle    string `json:"originalTitle"`
 	ParentIndex      int    `json:"parentIndex"`
 	Index            int    `json:"index"`
+	AbsoluteIndex    int    `json:"absoluteIndex"`
+	AirDate          string `json:"originallyAvailableAt"` // YYYY-MM-DD
 	Guid             string `json:"guid"`
-	Player           struct {
-		State string `json:"state"`
+	ParentGuid       string `json:"parentGuid"`
+	GrandparentGuid  string `json:"grandparentGuid"`
+	Guids            []struct {
+		ID string `json:"id"`
+	} `json:"Guid"`
+	Player struct {
+		State   string `json:"state"`
+		Product string `json:"product"`
 	} `json:"Player"`
-	ViewedAt int64 `json:"viewedAt"`
-	User     struct {
+	ViewedAt        int64   `json:"viewedAt"`
+	UserRating      float64 `json:"userRating"`  // Out of 10, in half stars
+	LastRatedAt     int64   `json:"lastRatedAt"` // Unix time
+	ViewCount       int     `json:"viewCount"`
+	LastViewedAt    int64   `json:"lastViewedAt"`
+	LeafCount       int     `json:"leafCount"`       // Episodes of a show
+	ViewedLeafCount int     `json:"viewedLeafCount"` // Watched episodes of a show
+	Collection      []Tag   `json:"Collection"`
+	AddedAt         int64   `json:"addedAt"`
+	Media           []Media `json:"Media"`
+	User            struct {
 		ID    string `json:"id"`
 		Title string `json:"title"`
 	} `json:"User"`
-	LibrariesSectionID  string `json:"librarySectionID"`
-	LibrariesSectionKey string `json:"librarySectionKey"`
-	LibraryName         string `json:"librarySectionTitle"`
-	AccountId           int    `json:"accountID"` // Added for compatibility with Plex API
+	LibrariesSectionID  json.Number `json:"librarySectionID"` // A number in library responses, a string in sessions
+	LibrariesSectionKey string      `json:"librarySectionKey"`
+	LibraryName         string      `json:"librarySectionTitle"`
+	AccountId           int         `json:"accountID"` // Added for compatibility with Plex API
+}
+
+func init() {
+	registry.Register(registry.Definition{
+		ServerType: config.ServerType{
+			Name:  config.Plex,
+			Label: "Plex",
+			Fields: append([]config.Field{
+				{Name: "url", Label: "URL", Kind: config.FieldURL, Required: true, Placeholder: "http://localhost:32400"},
+				{Name: "token", Label: "Token", Kind: config.FieldPassword, Required: true},
+				{Name: "username", Label: "Username", Kind: config.FieldText, Help: "Only sync this user's sessions"},
+			}, append(config.RateLimitFields, config.MatchFields...)...),
+			Capabilities: []config.Capability{
+				config.CapabilitySessions,
+				config.CapabilityHistory,
+				config.CapabilityScrobble,
+				config.CapabilityHistoryWrite,
+				config.CapabilityRatings,
+				config.CapabilityListMirror,
+				config.CapabilityLibrary,
+				config.CapabilityResume,
+				config.CapabilityPlayed,
+				config.CapabilityUnwatch,
+				config.CapabilityPlayCount,
+			},
+		},
+		New: func(name string, cfg config.Server) (registry.Server, error) {
+			return New(name, cfg)
+		},
+	})
 }
 
 // New creates a new Plex client
 func New(name string, config config.Server) (*Plex, error) {
 	if config.URL == "" || config.Token == "" {
-		return nil, fmt.Errorf("missing required Plex configuration")
+		return nil, registry.Permanent(fmt.Errorf("missing required Plex configuration"))
 	}
 
 	// Remove trailing slash if present
 	config.URL = strings.TrimSuffix(config.URL, "/")
 
+	// Every request is tagged as Scroblarr. Progress and scrobble writes open no session, so Plex keeps
+	// no trace of the tag on them, and the sync's write journal is what keeps them from looping back.
 	headers := map[string]string{
-		"Accept":       "application/json",
-		"X-Plex-Token": config.Token,
+		"Accept":                   "application/json",
+		"X-Plex-Token":             config.Token,
+		"X-Plex-Product":           "Scroblarr",
+		"X-Plex-Client-Identifier": "scroblarr-" + name,
 	}
 	_logger := logger.NewLogger("plex")
 	client := request.New(
 		request.WithHeaders(headers),
 		request.WithLogger(_logger),
+		request.WithRateLimiter(config.RateLimiter()),
+		request.WithWriteRateLimiter(config.WriteRateLimiter()),
 	)
 
 	s := &Plex{
@@ -89,6 +171,40 @@ func New(name string, config config.Server) (*Plex, error) {
 	return s, nil
 }
 
+// legacyAgents maps the databases of the legacy Plex agents to their provider names
+var legacyAgents = map[string]string{
+	"imdb":       "imdb",
+	"themoviedb": "tmdb",
+	"thetvdb":    "tvdb",
+}
+
+// guidIDs reads the IDs of an item, and of its show for episodes. The new Plex agents list
+// external IDs in Guids, e.g. "tmdb://278". The legacy agents have a single guid such as
+// "com.plexapp.agents.imdb://tt0111161?lang=en", or "com.plexapp.agents.thetvdb://121361/1/1?lang=en"
+// for an episode, which only identifies its show.
+func guidIDs(item Metadata) (types.IDs, types.IDs) {
+	ids := types.IDs{Plex: item.RatingKey}
+	show := types.IDs{Plex: item.GrandparentKey}
+
+	if agent, id, ok := strings.Cut(item.Guid, "://"); ok {
+		agent = agent[strings.LastIndex(agent, ".")+1:]
+		id, _, _ = strings.Cut(id, "?")
+		if anidb, ok := strings.CutPrefix(id, "anidb-"); ok && agent == "hama" {
+			ids.AniDB = anidb
+		} else if showID, _, episode := strings.Cut(id, "/"); episode {
+			show.Set(legacyAgents[agent], showID)
+		} else {
+			ids.Set(legacyAgents[agent], id)
+		}
+	}
+	for _, guid := range item.Guids {
+		if provider, id, ok := strings.Cut(guid.ID, "://"); ok {
+			ids.Set(provider, id)
+		}
+	}
+	return ids, show
+}
+
 func (p *Plex) plexItemsToMediaSessions(items []Metadata) []types.MediaSession {
 	var sessions []types.MediaSession
 	for _, item := range items {
@@ -105,19 +221,14 @@ func (p *Plex) plexItemsToMediaSessions(items []Metadata) []types.MediaSession {
 			ViewOffset: item.ViewOffset,
 			State:      item.Player.State,
 			Progress:   misc.CalculateProgress(item.ViewOffset, item.Duration),
+			ViewedAt:   item.ViewedAt,
 		}
 
-		// Extract IDs from guid
-		if strings.Contains(item.Guid, "imdb") {
-			parts := strings.Split(item.Guid, "//")
-			if len(parts) > 1 {
-				session.IMDBID = strings.TrimSuffix(parts[1], "?")
-			}
-		} else if strings.Contains(item.Guid, "tvdb") {
-			parts := strings.Split(item.Guid, "//")
-			if len(parts) > 1 {
-				session.TVDBID = strings.TrimSuffix(parts[1], "?")
-			}
+		session.IDs, session.ShowIDs = guidIDs(item)
+
+		if item.Type != "track" {
+			// Tracks use it for the track artist instead
+			session.OriginalTitle = item.OriginalTitle
 		}
 
 		// Handle TV shows
@@ -126,6 +237,31 @@ func (p *Plex) plexItemsToMediaSessions(items []Metadata) []types.MediaSession {
 			session.EpisodeTitle = item.Title
 			session.SeasonNum = item.ParentIndex
 			session.EpisodeNum = item.Index
+			session.AbsoluteNum = item.AbsoluteIndex
+			session.AirDate = item.AirDate
+			session.EpisodeNumEnd = lastEpisode(item)
+		}
+
+		// Handle music tracks
+		if item.Type == "track" {
+			session.Artist = item.GrandparentTitle
+			if item.OriginalTitle != "" {
+				// Track artist differs from the album artist
+				session.Artist = item.OriginalTitle
+			}
+			session.Album = item.ParentTitle
+			session.TrackNum = item.Index
+			for _, guid := range item.Guids {
+				if mbid, ok := strings.CutPrefix(guid.ID, "mbid://"); ok {
+					session.RecordingMBID = mbid
+				}
+			}
+			if mbid, ok := strings.CutPrefix(item.ParentGuid, "mbid://"); ok {
+				session.ReleaseMBID = mbid
+			}
+			if mbid, ok := strings.CutPrefix(item.GrandparentGuid, "mbid://"); ok {
+				session.ArtistMBIDs = []string{mbid}
+			}
 		}
 
 		session.User = types.User{
@@ -153,7 +289,7 @@ func (p *Plex) GetSessions() ([]types.MediaSession, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+		return nil, registry.StatusError("plex", resp.StatusCode)
 	}
 
 	var container Session
@@ -161,102 +297,20 @@ func (p *Plex) GetSessions() ([]types.MediaSession, error) {
 		return nil, err
 	}
 
-	sessions := p.plexItemsToMediaSessions(container.MediaContainer.Metadata)
+	items := make([]Metadata, 0, len(container.MediaContainer.Metadata))
+	for _, item := range container.MediaContainer.Metadata {
+		// Skip the sessions scrobbled by Scroblarr itself
+		if item.Player.Product == "Scroblarr" {
+			p.logger.Trace().Str("title", item.Title).Msg("Skipping Scroblarr's own session")
+			continue
+		}
+		items = append(items, item)
+	}
+	sessions := p.plexItemsToMediaSessions(items)
 
 	return sessions, nil
 }
 
-// GetWatchHistory returns the watch history from Plex
-func (p *Plex) GetWatchHistory() ([]types.MediaSession, error) {
-
-	var allWatchedItems []types.MediaSession
-
-	// For each section, get watched items
-	//url := fmt.Sprintf("%s/status/sessions/history/all", s.config.URL)
-	//
-	//req, err := http.NewRequest("GET", url, nil)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//
-	//resp, err := s.client.Do(req)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//
-	//if resp.StatusCode != http.StatusOK {
-	//	err := resp.Body.Close()
-	//	if err != nil {
-	//		return nil, err
-	//	}
-	//	s.logger.Error().
-	//		Int("status_code", resp.StatusCode).
-	//		Msg("Failed to get watch history for section")
-	//	return nil, fmt.Errorf("plex API returned status code %d", resp.StatusCode)
-	//}
-	//
-	//var container Session
-	//if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
-	//	if err := resp.Body.Close(); err != nil {
-	//		return nil, fmt.Errorf("error decoding Plex response: %w", err)
-	//	}
-	//	return nil, err
-	//}
-	//if err := resp.Body.Close(); err != nil {
-	//	return nil, err
-	//}
-	//
-	//// Process each watched item
-	//for _, item := range container.MediaContainer.Metadata {
-	//	session := types.MediaSession{
-	//		SessionID:  item.RatingKey,
-	//		Title:      item.Title,
-	//		Type:       item.Type,
-	//		Year:       item.Year,
-	//		Duration:   item.Duration,
-	//		ViewOffset: item.Duration, // For history items, assume they're complete
-	//		State:      "stopped",     // History items are completed
-	//		Progress:   100,           // 100% progress for history items
-	//		ViewedAt:   item.ViewedAt,
-	//	}
-	//
-	//	// Extract IDs from guid
-	//	if strings.Contains(item.Guid, "imdb") {
-	//		parts := strings.Split(item.Guid, "//")
-	//		if len(parts) > 1 {
-	//			session.IMDBID = strings.TrimSuffix(parts[1], "?")
-	//		}
-	//	} else if strings.Contains(item.Guid, "tvdb") {
-	//		parts := strings.Split(item.Guid, "//")
-	//		if len(parts) > 1 {
-	//			session.TVDBID = strings.TrimSuffix(parts[1], "?")
-	//		}
-	//	}
-	//
-	//	// Handle TV shows
-	//	if item.Type == "episode" {
-	//		session.ShowTitle = item.GrandparentTitle
-	//		session.EpisodeTitle = item.Title
-	//		session.SeasonNum = item.ParentIndex
-	//		session.EpisodeNum = item.Index
-	//	}
-	//
-	//	// Add user info if available
-	//	session.User = types.User{
-	//		ID:       item.User.ID,
-	//		Username: item.User.Title,
-	//	}
-	//
-	//	allWatchedItems = append(allWatchedItems, session)
-	//}
-	//
-	//s.logger.Info().
-	//	Int("count", len(allWatchedItems)).
-	//	Msg("Retrieved watch history from Plex")
-
-	return allWatchedItems, nil
-}
-
 // GetServerType returns the type of this server
 func (p *Plex) GetServerType() string {
 	return "plex"
@@ -267,36 +321,13 @@ func (p *Plex) GetName() string {
 	return p.name
 }
 
-func (p *Plex) SyncHistory(session types.MediaSession) error {
-	//TODO implement me
-	return nil
-}
-
 func (p *Plex) Scrobble(session types.MediaSession, action string) error {
-	results, err := p.search(session)
+	item, err := p.find(session)
 	if err != nil {
-		return fmt.Errorf("failed to search for media: %w", err)
-	}
-	if len(results) == 0 {
-		return fmt.Errorf("no matching media found for scrobble")
+		return err
 	}
-	errChan := make(chan error, len(results))
-	for _, item := range results {
-		go func(item types.MediaSession) {
-			if err := p.scrobble(item.SessionID, session); err != nil {
-				errChan <- fmt.Errorf("failed to scrobble item %s: %w", item.Title, err)
-			}
-		}(item)
-	}
-	close(errChan)
-	var scrobbleErrors []error
-	for err := range errChan {
-		if err != nil {
-			scrobbleErrors = append(scrobbleErrors, err)
-		}
-	}
-	if len(scrobbleErrors) > 0 {
-		return fmt.Errorf("scrobble errors occurred: %v", scrobbleErrors)
+	if err := p.scrobble(item.SessionID, session); err != nil {
+		return fmt.Errorf("failed to scrobble item %s: %w", item.Title, err)
 	}
 	p.logger.Trace().
 		Str("action", action).
@@ -306,11 +337,52 @@ func (p *Plex) Scrobble(session types.MediaSession, action string) error {
 	return nil
 }
 
+// SyncHistory marks a completed item as played
+func (p *Plex) SyncHistory(session types.MediaSession) error {
+	item, err := p.find(session)
+	if err != nil {
+		return err
+	}
+	if err := p.markAsPlayed(item.SessionID); err != nil {
+		return fmt.Errorf("failed to mark %s as played: %w", item.Title, err)
+	}
+	p.logger.Trace().
+		Str("title", session.Title).
+		Str("item", item.SessionID).
+		Msgf("Marked as played in %s", p.name)
+	return nil
+}
+
+// markAsPlayed marks an item as watched for the account of the token
+func (p *Plex) markAsPlayed(key string) error {
+	query := url.Values{}
+	query.Add("key", key)
+	query.Add("identifier", "com.plexapp.plugins.library")
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/:/scrobble?%s", p.config.URL, query.Encode()), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func (p *Plex) scrobble(key string, item types.MediaSession) error {
+	return p.setProgress(key, item.State, item.ViewOffset)
+}
+
+// setProgress reports the playback state and position of an item, in milliseconds
+func (p *Plex) setProgress(key, state string, offset int64) error {
 	query := url.Values{}
 	query.Add("key", key)
-	query.Add("state", item.State)
-	query.Add("time", fmt.Sprintf("%d", item.ViewOffset))
+	query.Add("state", state)
+	query.Add("time", fmt.Sprintf("%d", offset))
 	query.Add("identifier", "com.plexapp.plugins.library")
 
 	_url := fmt.Sprintf("%s/:/progress", p.config.URL)
@@ -323,6 +395,7 @@ func (p *Plex) scrobble(key string, item types.MediaSession) error {
 	if err != nil {
 		return fmt.Errorf("failed to send scrobble request: %w", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("plex API returned status code %d", resp.StatusCode)
 	}
@@ -0,0 +1,19 @@
+package plex
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// Preview reports the library item a write for session would change, without changing them
+func (p *Plex) Preview(session types.MediaSession, action string) (string, error) {
+	if getMediaType(session.Type) == "0" {
+		return "", fmt.Errorf("%w: %s", registry.ErrUnsupported, session.Type)
+	}
+	item, err := p.find(session)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s (%s)", action, item.Title, item.SessionID), nil
+}
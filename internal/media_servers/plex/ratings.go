@@ -0,0 +1,103 @@
+package plex
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ratingScale is the maximum userRating, Plex shows it as five stars
+const ratingScale = 10
+
+// GetRatings returns the rated movies and episodes of the token's account
+func (p *Plex) GetRatings() ([]types.Rating, error) {
+	ratings := make([]types.Rating, 0)
+	for _, library := range p.libraries {
+		// Plex type codes, 1 is a movie and 4 an episode
+		var mediaType string
+		switch library.Type {
+		case "movie":
+			mediaType = "1"
+		case "show":
+			mediaType = "4"
+		default:
+			continue
+		}
+		// Plex filters with operators in the parameter name, userRating>>=0 means a rating above 0
+		items, err := p.getItemsWhere(library.ID, mediaType, "userRating>>=0")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ratings of %s: %w", library.Name, err)
+		}
+		for _, item := range items {
+			value := types.RatingFromScale(item.UserRating, ratingScale)
+			sessions := p.plexItemsToMediaSessions([]Metadata{item})
+			if value == 0 || len(sessions) == 0 {
+				continue
+			}
+			ratings = append(ratings, types.Rating{
+				Session: sessions[0],
+				Value:   value,
+				RatedAt: item.LastRatedAt,
+			})
+		}
+	}
+	p.logger.Debug().
+		Int("count", len(ratings)).
+		Msgf("Retrieved ratings from %s", p.name)
+	return ratings, nil
+}
+
+// getItemsWhere lists the items of a type in a library matching a filter
+func (p *Plex) getItemsWhere(libraryID, mediaType, filter string) ([]Metadata, error) {
+	query := url.Values{}
+	query.Set("type", mediaType)
+	query.Set("includeGuids", "1")
+	items, err := p.getItems(fmt.Sprintf("/library/sections/%s/all?%s", libraryID, filter), query)
+	if err != nil {
+		return nil, err
+	}
+	// Sessions are filtered by username, library items have no user
+	for i := range items {
+		items[i].User.Title = ""
+	}
+	return items, nil
+}
+
+// SetRating rates the matching item for the token's account
+func (p *Plex) SetRating(rating types.Rating) error {
+	item, err := p.find(rating.Session)
+	if err != nil {
+		return err
+	}
+	if err := p.rate(item.SessionID, rating.Scaled(ratingScale)); err != nil {
+		return fmt.Errorf("failed to rate %s: %w", item.Title, err)
+	}
+	p.logger.Trace().
+		Str("title", rating.Session.Title).
+		Int("rating", rating.Value).
+		Msgf("Rated in %s", p.name)
+	return nil
+}
+
+// rate sets the userRating of an item
+func (p *Plex) rate(key string, value float64) error {
+	query := url.Values{}
+	query.Add("key", key)
+	query.Add("identifier", "com.plexapp.plugins.library")
+	query.Add("rating", strconv.FormatFloat(value, 'f', -1, 64))
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/:/rate?%s", p.config.URL, query.Encode()), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package plex
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// resumeTolerance is how far apart, in milliseconds, two resume positions can be and still count as the same
+const resumeTolerance = 5000
+
+// SetResumePosition sets where the user left off an item to the position of the session.
+// An item already resuming there is left alone.
+func (p *Plex) SetResumePosition(session types.MediaSession) error {
+	item, err := p.find(session)
+	if err != nil {
+		return err
+	}
+	if diff := item.ViewOffset - session.ViewOffset; diff > -resumeTolerance && diff < resumeTolerance {
+		return nil
+	}
+	if err := p.setProgress(item.SessionID, "stopped", session.ViewOffset); err != nil {
+		return fmt.Errorf("failed to set resume position of %s: %w", item.Title, err)
+	}
+	p.logger.Trace().
+		Str("title", session.Title).
+		Int64("position", session.ViewOffset).
+		Msgf("Set resume position in %s", p.name)
+	return nil
+}
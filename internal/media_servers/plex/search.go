@@ -3,12 +3,15 @@ package plex
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/matcher"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/internal/types"
 	"net/http"
 	"net/url"
 )
 
-// getMediaType converts a media type string to a Plex-specific media type code
+// getMediaType converts a media type string to a Plex-specific media type code. Tracks are not looked
+// up, the matcher scores titles without their artists.
 func getMediaType(mediaType string) string {
 	switch mediaType {
 	case "movie":
@@ -16,8 +19,6 @@ func getMediaType(mediaType string) string {
 	case "show":
 		return "2"
 	case "episode":
-		return "3"
-	case "music":
 		return "4"
 	default:
 		return "0" // Default to 0 for unknown types
@@ -27,7 +28,7 @@ func getMediaType(mediaType string) string {
 func (p *Plex) search(session types.MediaSession) ([]types.MediaSession, error) {
 	mediaType := getMediaType(session.Type)
 	if mediaType == "0" {
-		return nil, fmt.Errorf("unsupported media type: %s", session.Type)
+		return nil, fmt.Errorf("%w: %s", registry.ErrUnsupported, session.Type)
 	}
 
 	_url := fmt.Sprintf("%s/library/all", p.config.URL)
@@ -36,9 +37,7 @@ func (p *Plex) search(session types.MediaSession) ([]types.MediaSession, error)
 	query := url.Values{}
 	query.Add("type", mediaType)
 	query.Add("title", session.Title)
-	if session.Year > 0 {
-		query.Add("year", fmt.Sprintf("%d", session.Year))
-	}
+	query.Add("includeGuids", "1")
 	_url += "?" + query.Encode()
 	req, err := http.NewRequest("GET", _url, nil)
 	if err != nil {
@@ -48,6 +47,7 @@ func (p *Plex) search(session types.MediaSession) ([]types.MediaSession, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("plex API returned status code %d", resp.StatusCode)
 	}
@@ -60,3 +60,50 @@ func (p *Plex) search(session types.MediaSession) ([]types.MediaSession, error)
 	sessions := p.plexItemsToMediaSessions(container.MediaContainer.Metadata)
 	return sessions, nil
 }
+
+// find returns the library item matching session, refusing title matches below the minimum confidence
+// and ties between different items
+func (p *Plex) find(session types.MediaSession) (types.MediaSession, error) {
+	results, err := p.search(session)
+	if err != nil {
+		return types.MediaSession{}, fmt.Errorf("failed to search for media: %w", err)
+	}
+	minScore := p.config.GetMinConfidence()
+	match, score, ok := matcher.Best(session, results, minScore)
+	if !ok && session.Type == "episode" && session.ShowTitle != "" {
+		// Episodes without a title of their own, such as the later episodes of a multi-episode file,
+		// are found by their numbers
+		episodes, err := p.showEpisodes(session)
+		if err != nil {
+			p.logger.Debug().Err(err).Msgf("Failed to list the episodes of %s", session.ShowTitle)
+		} else {
+			results = episodes
+			match, score, ok = matcher.Best(session, results, minScore)
+		}
+	}
+	if !ok {
+		if len(results) == 0 {
+			return types.MediaSession{}, fmt.Errorf("%w for %s", registry.ErrNotFound, session.Title)
+		}
+		return types.MediaSession{}, fmt.Errorf("%w, no confident match for %s, best score %.2f is below %.2f or tied", registry.ErrNotFound, session.Title, score, minScore)
+	}
+	if score < 1 {
+		p.logger.Debug().Msgf("Matched %s to %s by title with a score of %.2f", session.Title, match.Title, score)
+	}
+	return match, nil
+}
+
+// showEpisodes returns the episodes of the show of an episode
+func (p *Plex) showEpisodes(session types.MediaSession) ([]types.MediaSession, error) {
+	show, err := p.find(types.MediaSession{Type: "show", Title: session.ShowTitle, IDs: session.ShowIDs})
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("includeGuids", "1")
+	items, err := p.getItems("/library/metadata/"+show.SessionID+"/allLeaves", query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get episodes of %s: %w", show.Title, err)
+	}
+	return p.plexItemsToMediaSessions(items), nil
+}
@@ -0,0 +1,91 @@
+package plex
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"net/http"
+	"net/url"
+)
+
+// GetPlayed returns the watched movies and episodes of the token's account
+func (p *Plex) GetPlayed() ([]types.MediaSession, error) {
+	played := make([]types.MediaSession, 0)
+	for _, library := range p.libraries {
+		// Plex type codes, 1 is a movie and 4 an episode
+		var mediaType string
+		switch library.Type {
+		case "movie":
+			mediaType = "1"
+		case "show":
+			mediaType = "4"
+		default:
+			continue
+		}
+		items, err := p.getItemsWhere(library.ID, mediaType, "viewCount>>=0")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get watched items of %s: %w", library.Name, err)
+		}
+		for _, item := range items {
+			sessions := p.plexItemsToMediaSessions([]Metadata{item})
+			if len(sessions) == 0 {
+				continue
+			}
+			session := sessions[0]
+			session.PlayCount = item.ViewCount
+			session.ViewedAt = item.LastViewedAt
+			played = append(played, session)
+		}
+	}
+	return played, nil
+}
+
+// IsPlayed reports whether an item listed by GetPlayed is still watched, and still in the library
+func (p *Plex) IsPlayed(session types.MediaSession) (bool, bool, error) {
+	if session.IDs.Plex == "" {
+		return false, false, fmt.Errorf("%s has no Plex rating key", session.Title)
+	}
+	item, err := p.getMetadata(session.IDs.Plex)
+	if errors.Is(err, errItemNotFound) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return item.ViewCount > 0, true, nil
+}
+
+// MarkUnwatched marks the matching item unwatched for the token's account
+func (p *Plex) MarkUnwatched(session types.MediaSession) error {
+	item, err := p.find(session)
+	if err != nil {
+		return err
+	}
+	if err := p.unscrobble(item.SessionID); err != nil {
+		return fmt.Errorf("failed to mark %s unwatched: %w", item.Title, err)
+	}
+	p.logger.Trace().
+		Str("title", session.Title).
+		Msgf("Marked unwatched in %s", p.name)
+	return nil
+}
+
+// unscrobble resets the view count of an item
+func (p *Plex) unscrobble(key string) error {
+	query := url.Values{}
+	query.Add("key", key)
+	query.Add("identifier", "com.plexapp.plugins.library")
+	req, err := http.NewRequest("GET", p.config.URL+"/:/unscrobble?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("plex API returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
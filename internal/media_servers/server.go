@@ -1,54 +1,290 @@
 package media_servers
 
 import (
-	"fmt"
+	"context"
+	"github.com/rs/zerolog"
 	"github.com/sirrobot01/scroblarr/internal/config"
-	"github.com/sirrobot01/scroblarr/internal/media_servers/emby_jellyfin"
-	"github.com/sirrobot01/scroblarr/internal/media_servers/plex"
-	"github.com/sirrobot01/scroblarr/internal/types"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+
+	// Register the built-in server and target types
+	_ "github.com/sirrobot01/scroblarr/internal/listenbrainz"
+	_ "github.com/sirrobot01/scroblarr/internal/media_servers/emby_jellyfin"
+	_ "github.com/sirrobot01/scroblarr/internal/media_servers/plex"
+	_ "github.com/sirrobot01/scroblarr/internal/trakt"
+	_ "github.com/sirrobot01/scroblarr/internal/webhook"
 )
 
 // Server is the interface all media server clients must implement
-type Server interface {
-	GetSessions() ([]types.MediaSession, error)
-	GetWatchHistory() ([]types.MediaSession, error)
-	Connect() error
-	GetName() string
-	GetServerType() string
-	Scrobble(session types.MediaSession, action string) error
-	SyncHistory(session types.MediaSession) error
-	GetConfig() config.Server
-}
-
-// NewServer creates a new media server client based on the configuration
-func newServer(name string, config config.Server) (Server, error) {
-	switch config.Type {
-	case "plex":
-		return plex.New(name, config)
-	case "jellyfin":
-		return emby_jellyfin.NewJellyfin(name, config)
-	case "emby":
-		return emby_jellyfin.NewEmby(name, config)
-	default:
-		return nil, fmt.Errorf("unsupported media server type: %s", config.Type)
-	}
-}
-
-func New() (map[string]Server, error) {
+type Server = registry.Server
+
+// Capabilities a server may implement, see the registry package
+type (
+	SessionSource      = registry.SessionSource
+	HistorySource      = registry.HistorySource
+	IncrementalHistory = registry.IncrementalHistory
+	LiveScrobbler      = registry.LiveScrobbler
+	HistoryWriter      = registry.HistoryWriter
+	BatchHistoryWriter = registry.BatchHistoryWriter
+	RatingsSync        = registry.RatingsSync
+	WatchlistSource    = registry.WatchlistSource
+	ListMirror         = registry.ListMirror
+	LibrarySource      = registry.LibrarySource
+	CollectionWriter   = registry.CollectionWriter
+	IDResolver         = registry.IDResolver
+	EpisodeGuide       = registry.EpisodeGuide
+	ResumeWriter       = registry.ResumeWriter
+	PlayedSource       = registry.PlayedSource
+	UnwatchWriter      = registry.UnwatchWriter
+	PlayCountWriter    = registry.PlayCountWriter
+	Previewer          = registry.Previewer
+)
+
+// ErrUnsupported is returned by Preview for items a target does not take
+var ErrUnsupported = registry.ErrUnsupported
+
+// ErrNotFound is wrapped by the errors of writes to items a target does not have
+var ErrNotFound = registry.ErrNotFound
+
+// IsPermanent reports whether a connection error cannot be fixed by retrying
+var IsPermanent = registry.IsPermanent
+
+const (
+	minBackoff = 10 * time.Second
+	maxBackoff = 5 * time.Minute
+	// degradeAfter is how many requests in a row have to fail before a connected server is reconnected
+	degradeAfter = 3
+)
+
+var (
+	StatusConnected = "connected"
+	StatusDegraded  = "degraded"
+	// StatusFailed is set for servers that are not retried, e.g. after rejecting their credentials
+	StatusFailed = "failed"
+)
+
+// Health is the connection state of a configured server
+type Health struct {
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	Attempts      int       `json:"attempts,omitempty"` // Failed attempts since the last connection
+	Failures      int       `json:"failures,omitempty"` // Failed requests in a row while connected
+	LastAttempt   time.Time `json:"last_attempt"`
+	LastConnected time.Time `json:"last_connected,omitempty"`
+	NextAttempt   time.Time `json:"next_attempt,omitempty"`
+}
+
+// Pool holds the configured servers. Servers that cannot be reached are kept
+// degraded and reconnected in the background with backoff.
+type Pool struct {
+	configs      map[string]config.Server
+	servers      map[string]Server
+	health       map[string]*Health
+	reconnecting map[string]bool
+	ctx          context.Context
+	mu           sync.RWMutex
+	logger       zerolog.Logger
+}
+
+// New creates a client for every configured server. It does not fail when a server
+// is unreachable; call Start to keep retrying those in the background.
+func New() (*Pool, error) {
 	cfg := config.Get()
-	_log := logger.GetDefault()
-	servers := make(map[string]Server)
-	for i, c := range cfg.Servers {
-		if server, err := newServer(i, c); err != nil {
-			_log.Error().Err(err).Msgf("Failed to connect to %s", i)
-		} else {
-			servers[i] = server
+	p := &Pool{
+		configs:      cfg.Servers,
+		servers:      make(map[string]Server),
+		health:       make(map[string]*Health),
+		reconnecting: make(map[string]bool),
+		logger:       logger.GetDefault(),
+	}
+	for name := range cfg.Servers {
+		if err := p.connect(name); err != nil {
+			if IsPermanent(err) {
+				p.logger.Error().Err(err).Msgf("Failed to connect to %s, fix its settings and restart", name)
+				continue
+			}
+			p.logger.Error().Err(err).Msgf("Failed to connect to %s, retrying in the background", name)
+		}
+	}
+	return p, nil
+}
+
+// Start reconnects degraded servers until the context is cancelled
+func (p *Pool) Start(ctx context.Context) {
+	p.mu.Lock()
+	p.ctx = ctx
+	degraded := make([]string, 0)
+	for name, health := range p.health {
+		if health.Status == StatusDegraded {
+			degraded = append(degraded, name)
+		}
+	}
+	p.mu.Unlock()
+	for _, name := range degraded {
+		p.startReconnect(name)
+	}
+}
+
+// Get returns a connected server
+func (p *Pool) Get(name string) (Server, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if health, ok := p.health[name]; !ok || health.Status != StatusConnected {
+		return nil, false
+	}
+	server, ok := p.servers[name]
+	return server, ok
+}
+
+// Names returns the names of all configured servers, sorted
+func (p *Pool) Names() []string {
+	names := make([]string, 0, len(p.configs))
+	for name := range p.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Health returns the connection state of every configured server, sorted by name
+func (p *Pool) Health() []Health {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	health := make([]Health, 0, len(p.health))
+	for _, h := range p.health {
+		health = append(health, *h)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Name < health[j].Name
+	})
+	return health
+}
+
+// MarkDegraded records a failed request to a connected server. After several failures in a row
+// the server is reconnected in the background, unless the error is permanent.
+func (p *Pool) MarkDegraded(name string, err error) {
+	p.mu.Lock()
+	health, ok := p.health[name]
+	if !ok || health.Status != StatusConnected {
+		p.mu.Unlock()
+		return
+	}
+	health.Error = err.Error()
+	if IsPermanent(err) {
+		health.Status = StatusFailed
+		p.mu.Unlock()
+		p.logger.Error().Err(err).Msgf("Server %s rejected Scroblarr, fix its settings and restart", name)
+		return
+	}
+	health.Failures++
+	if health.Failures < degradeAfter {
+		p.mu.Unlock()
+		return
+	}
+	health.Status = StatusDegraded
+	p.mu.Unlock()
+	p.logger.Warn().Err(err).Msgf("Server %s is unreachable, reconnecting in the background", name)
+	p.startReconnect(name)
+}
+
+// MarkHealthy records a successful request to a server, resetting its failures
+func (p *Pool) MarkHealthy(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if health, ok := p.health[name]; ok && health.Status == StatusConnected {
+		health.Failures = 0
+		health.Error = ""
+	}
+}
+
+// connect creates the client of a server if needed and checks the connection
+func (p *Pool) connect(name string) error {
+	cfg := p.configs[name]
+	p.mu.RLock()
+	server, exists := p.servers[name]
+	p.mu.RUnlock()
+
+	var err error
+	if exists {
+		err = server.Connect()
+	} else {
+		// Constructors connect, so a failure here is usually the server being down
+		server, err = registry.New(name, cfg)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	health, ok := p.health[name]
+	if !ok {
+		health = &Health{Name: name, Type: string(cfg.Type)}
+		p.health[name] = health
+	}
+	health.LastAttempt = time.Now()
+	if err != nil {
+		health.Status = StatusDegraded
+		if IsPermanent(err) {
+			health.Status = StatusFailed
 		}
+		health.Error = err.Error()
+		health.Attempts++
+		return err
 	}
+	p.servers[name] = server
+	health.Status = StatusConnected
+	health.Error = ""
+	health.Attempts = 0
+	health.Failures = 0
+	health.LastConnected = health.LastAttempt
+	health.NextAttempt = time.Time{}
+	return nil
+}
 
-	if len(servers) == 0 {
-		return nil, fmt.Errorf("no server found")
+// startReconnect retries a degraded server in the background, once Start has been called
+func (p *Pool) startReconnect(name string) {
+	p.mu.Lock()
+	if p.ctx == nil || p.reconnecting[name] {
+		p.mu.Unlock()
+		return
 	}
-	return servers, nil
+	p.reconnecting[name] = true
+	ctx := p.ctx
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.reconnecting, name)
+			p.mu.Unlock()
+		}()
+
+		backoff := minBackoff
+		for {
+			p.mu.Lock()
+			p.health[name].NextAttempt = time.Now().Add(backoff)
+			p.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			if err := p.connect(name); err != nil {
+				if IsPermanent(err) {
+					p.logger.Error().Err(err).Msgf("Giving up reconnecting to %s, fix its settings and restart", name)
+					return
+				}
+				p.logger.Debug().Err(err).Msgf("Reconnecting to %s failed", name)
+				backoff = min(backoff*2, maxBackoff)
+				continue
+			}
+			p.logger.Info().Msgf("Reconnected to %s", name)
+			return
+		}
+	}()
 }
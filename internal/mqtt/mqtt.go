@@ -0,0 +1,292 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"github.com/sirrobot01/scroblarr/pkg/logger"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var topicSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// queueSize is how many messages wait for the broker before new ones are dropped
+const queueSize = 100
+
+// State is the retained payload published for each server and user
+type State struct {
+	State      string  `json:"state"` // "playing", "paused" or "stopped"
+	Action     string  `json:"action"`
+	Server     string  `json:"server"`
+	User       string  `json:"user"`
+	Type       string  `json:"type,omitempty"`
+	Title      string  `json:"title,omitempty"`
+	Year       int     `json:"year,omitempty"`
+	ShowTitle  string  `json:"show_title,omitempty"`
+	SeasonNum  int     `json:"season_num,omitempty"`
+	EpisodeNum int     `json:"episode_num,omitempty"`
+	Artist     string  `json:"artist,omitempty"`
+	Album      string  `json:"album,omitempty"`
+	Progress   float64 `json:"progress"`
+	Duration   int64   `json:"duration,omitempty"`
+	ViewOffset int64   `json:"view_offset,omitempty"`
+	IMDBID     string  `json:"imdb_id,omitempty"`
+	TMDBID     string  `json:"tmdb_id,omitempty"`
+	TVDBID     string  `json:"tvdb_id,omitempty"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+// message is a retained message waiting to be published
+type message struct {
+	topic     string
+	payload   []byte
+	discovery string // The sensor a discovery config announces, "" for states
+}
+
+// Publisher publishes session state changes to an MQTT broker. Messages are queued and sent in the
+// background, so a slow or unreachable broker does not hold up the syncs.
+type Publisher struct {
+	config     *config.MQTT
+	client     paho.Client
+	logger     zerolog.Logger
+	queue      chan message
+	discovered map[string]bool
+	mu         sync.Mutex
+}
+
+// New connects to the configured broker
+func New(cfg *config.MQTT) (*Publisher, error) {
+	_logger := logger.NewLogger("mqtt")
+	p := &Publisher{
+		config:     cfg,
+		logger:     _logger,
+		queue:      make(chan message, queueSize),
+		discovered: make(map[string]bool),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10*time.Second).
+		SetWill(p.availabilityTopic(), "offline", 1, true).
+		SetOnConnectHandler(func(client paho.Client) {
+			_logger.Info().Msgf("Connected to MQTT broker %s", cfg.Broker)
+			client.Publish(p.availabilityTopic(), 1, true, "online")
+			// Discovery config may have been lost if the broker restarted
+			p.mu.Lock()
+			p.discovered = make(map[string]bool)
+			p.mu.Unlock()
+		}).
+		SetConnectionLostHandler(func(client paho.Client, err error) {
+			_logger.Error().Err(err).Msg("Lost connection to MQTT broker")
+		})
+
+	tlsConfig, err := getTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	p.client = paho.NewClient(opts)
+	token := p.client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		// Connection is retried in the background
+		_logger.Warn().Msgf("Timed out connecting to MQTT broker %s, retrying in the background", cfg.Broker)
+	} else if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	go p.run()
+	return p, nil
+}
+
+func getTLSConfig(cfg *config.MQTT) (*tls.Config, error) {
+	if cfg.TLS.CA == "" && cfg.TLS.Cert == "" && !cfg.TLS.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if cfg.TLS.CA != "" {
+		ca, err := os.ReadFile(cfg.TLS.CA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading mqtt CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in mqtt CA file %s", cfg.TLS.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLS.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading mqtt client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return fmt.Sprintf("%s/status", p.config.TopicPrefix)
+}
+
+func (p *Publisher) stateTopic(server, user string) string {
+	return fmt.Sprintf("%s/%s/%s/state", p.config.TopicPrefix, topicSegment(server), topicSegment(user))
+}
+
+// topicSegment makes a name safe to use as a single topic level
+func topicSegment(name string) string {
+	segment := strings.Trim(topicSanitizer.ReplaceAllString(name, "_"), "_")
+	if segment == "" {
+		return "unknown"
+	}
+	return segment
+}
+
+// Publish sends the state of a session as a retained message
+func (p *Publisher) Publish(server string, session types.MediaSession, action string) error {
+	user := session.User.Username
+	if user == "" {
+		user = session.User.ID
+	}
+
+	if p.config.Discovery {
+		if err := p.publishDiscovery(server, user); err != nil {
+			return err
+		}
+	}
+
+	state := State{
+		State:      session.State,
+		Action:     action,
+		Server:     server,
+		User:       user,
+		Type:       session.Type,
+		Title:      session.Title,
+		Year:       session.Year,
+		ShowTitle:  session.ShowTitle,
+		SeasonNum:  session.SeasonNum,
+		EpisodeNum: session.EpisodeNum,
+		Artist:     session.Artist,
+		Album:      session.Album,
+		Progress:   session.Progress,
+		Duration:   session.Duration,
+		ViewOffset: session.ViewOffset,
+		IMDBID:     session.IDs.IMDB,
+		TMDBID:     session.IDs.TMDB,
+		TVDBID:     session.IDs.TVDB,
+		Timestamp:  time.Now().Unix(),
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	p.enqueue(message{topic: p.stateTopic(server, user), payload: payload})
+	return nil
+}
+
+// publishDiscovery announces a Home Assistant sensor for a server and user, once per connection
+func (p *Publisher) publishDiscovery(server, user string) error {
+	id := fmt.Sprintf("scroblarr_%s_%s", topicSegment(server), topicSegment(user))
+	// Marked before it is sent, so it is queued once. A failed send clears the mark again.
+	p.mu.Lock()
+	done := p.discovered[id]
+	p.discovered[id] = true
+	p.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	stateTopic := p.stateTopic(server, user)
+	discovery := map[string]any{
+		"name":                  fmt.Sprintf("%s %s", server, user),
+		"unique_id":             id,
+		"object_id":             id,
+		"state_topic":           stateTopic,
+		"value_template":        "{{ value_json.state }}",
+		"json_attributes_topic": stateTopic,
+		"availability_topic":    p.availabilityTopic(),
+		"icon":                  "mdi:play-box-outline",
+		"device": map[string]any{
+			"identifiers":  []string{fmt.Sprintf("scroblarr_%s", topicSegment(server))},
+			"name":         fmt.Sprintf("Scroblarr %s", server),
+			"manufacturer": "Scroblarr",
+		},
+	}
+	payload, err := json.Marshal(discovery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal discovery config: %w", err)
+	}
+	topic := fmt.Sprintf("%s/sensor/%s/config", p.config.DiscoveryPrefix, id)
+	p.enqueue(message{topic: topic, payload: payload, discovery: id})
+	return nil
+}
+
+// enqueue queues a message for the background publisher, dropping it when the queue is full
+func (p *Publisher) enqueue(msg message) {
+	select {
+	case p.queue <- msg:
+	default:
+		p.logger.Warn().Str("topic", msg.topic).Msg("MQTT queue is full, dropping message")
+		if msg.discovery != "" {
+			p.forget(msg.discovery)
+		}
+	}
+}
+
+// run publishes the queued messages in order
+func (p *Publisher) run() {
+	for msg := range p.queue {
+		if err := p.publish(msg.topic, msg.payload); err != nil {
+			p.logger.Error().Err(err).Msg("Error publishing session state")
+			if msg.discovery != "" {
+				p.forget(msg.discovery)
+			}
+		}
+	}
+}
+
+// forget clears a sensor's discovery mark, so its config is sent again with the next state
+func (p *Publisher) forget(id string) {
+	p.mu.Lock()
+	delete(p.discovered, id)
+	p.mu.Unlock()
+}
+
+func (p *Publisher) publish(topic string, payload []byte) error {
+	token := p.client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	p.logger.Trace().Str("topic", topic).Msg("Published")
+	return nil
+}
+
+// Close marks Scroblarr offline and disconnects from the broker
+func (p *Publisher) Close() {
+	if !p.client.IsConnected() {
+		return
+	}
+	token := p.client.Publish(p.availabilityTopic(), 1, true, "offline")
+	token.WaitTimeout(5 * time.Second)
+	p.client.Disconnect(1000)
+}
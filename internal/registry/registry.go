@@ -0,0 +1,269 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Server is the interface all server clients must implement.
+// What else a server can do is expressed by the capability interfaces below, checked with type assertions.
+type Server interface {
+	Connect() error
+	GetName() string
+	GetServerType() string
+	GetConfig() config.Server
+}
+
+// SessionSource reports the sessions currently playing on a server
+type SessionSource interface {
+	Server
+	GetSessions() ([]types.MediaSession, error)
+}
+
+// HistorySource reads the completed plays of a server
+type HistorySource interface {
+	Server
+	GetWatchHistory() ([]types.MediaSession, error)
+}
+
+// IncrementalHistory is a HistorySource that can cheaply return only the plays after a point in time
+type IncrementalHistory interface {
+	HistorySource
+	GetWatchHistorySince(since time.Time) ([]types.MediaSession, error)
+}
+
+// LiveScrobbler receives playback progress as it happens
+type LiveScrobbler interface {
+	Server
+	Scrobble(session types.MediaSession, action string) error
+}
+
+// HistoryWriter records a completed play after the fact
+type HistoryWriter interface {
+	Server
+	SyncHistory(session types.MediaSession) error
+}
+
+// BatchHistoryWriter records many completed plays per request. It returns how many plays,
+// from the first, were sent before an error, and the plays the target could not match.
+type BatchHistoryWriter interface {
+	HistoryWriter
+	SyncHistoryBatch(sessions []types.MediaSession) (int, []types.MediaSession, error)
+}
+
+// RatingsSync reads and writes the user's ratings of movies and episodes
+type RatingsSync interface {
+	Server
+	GetRatings() ([]types.Rating, error)
+	SetRating(rating types.Rating) error
+}
+
+// WatchlistSource reads a watchlist and adds items to it
+type WatchlistSource interface {
+	Server
+	GetWatchlist() ([]types.MediaSession, error)
+	AddToWatchlist(items []types.MediaSession) error
+}
+
+// ListMirror keeps a named list of library items, such as a collection or favorites.
+// Listed items have a Progress of 100 once watched.
+type ListMirror interface {
+	Server
+	GetList(name string) ([]types.MediaSession, error)
+	// AddToList adds the library item matching item, reporting false when the library has no unwatched match
+	AddToList(name string, item types.MediaSession) (types.MediaSession, bool, error)
+	RemoveFromList(name string, item types.MediaSession) error
+}
+
+// LibrarySource lists the movies and episodes in a server's libraries
+type LibrarySource interface {
+	Server
+	GetLibraries() ([]types.Library, error)
+	GetLibraryItems(library types.Library) ([]types.LibraryItem, error)
+}
+
+// CollectionWriter records the movies and episodes the user owns
+type CollectionWriter interface {
+	Server
+	AddToCollection(items []types.LibraryItem) error
+	RemoveFromCollection(items []types.LibraryItem) error
+}
+
+// IDResolver looks up the missing external IDs of a movie, show or episode from those it has.
+// It returns the item's IDs, its show's IDs for an episode, and whether the item was found.
+type IDResolver interface {
+	Server
+	SearchIDs(mediaType string, ids types.IDs) (types.IDs, types.IDs, bool, error)
+}
+
+// ResumeWriter sets where the user left off a movie or episode, without playing it
+type ResumeWriter interface {
+	Server
+	SetResumePosition(session types.MediaSession) error
+}
+
+// PlayedSource lists the movies and episodes the user has watched. IsPlayed tells an item marked
+// unwatched apart from one removed from the library, which found is false for.
+type PlayedSource interface {
+	Server
+	GetPlayed() ([]types.MediaSession, error)
+	IsPlayed(session types.MediaSession) (played, found bool, err error)
+}
+
+// UnwatchWriter marks a movie or episode unwatched, removing its plays
+type UnwatchWriter interface {
+	Server
+	MarkUnwatched(session types.MediaSession) error
+}
+
+// PlayCountWriter adds plays to a movie or episode, the last one at session.ViewedAt. With no plays
+// it only moves the last played date, where the server allows setting it.
+type PlayCountWriter interface {
+	PlayedSource
+	AddPlays(session types.MediaSession, plays int) error
+}
+
+// EpisodeGuide lists the episodes of a show with their numbers in each episode order it knows
+type EpisodeGuide interface {
+	Server
+	GetEpisodes(show types.IDs) ([]types.EpisodeNumbers, error)
+}
+
+// Previewer looks up what a write for a movie, episode or track would send to a target, without sending it,
+// for dry runs. It returns an error when the target would not match the item, wrapping ErrUnsupported
+// for items the target does not take.
+type Previewer interface {
+	Server
+	Preview(session types.MediaSession, action string) (string, error)
+}
+
+// ErrUnsupported is returned by Preview for items a target does not take, e.g. tracks on Trakt
+var ErrUnsupported = errors.New("unsupported media type")
+
+// ErrNotFound is wrapped by the errors of writes to items a target does not have
+var ErrNotFound = errors.New("no matching item")
+
+// PermanentError is a connection error retrying cannot fix, such as rejected credentials or a missing setting
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as one retrying cannot fix
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked permanent
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// StatusError returns the error of an unexpected response status of a server's API. Rejected
+// credentials are permanent.
+func StatusError(server string, code int) error {
+	err := fmt.Errorf("%s API returned status code %d", server, code)
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return Permanent(err)
+	}
+	return err
+}
+
+// Supports reports whether a server implements a capability
+func Supports(server Server, capability config.Capability) bool {
+	var ok bool
+	switch capability {
+	case config.CapabilitySessions:
+		_, ok = server.(SessionSource)
+	case config.CapabilityHistory:
+		_, ok = server.(HistorySource)
+	case config.CapabilityScrobble:
+		_, ok = server.(LiveScrobbler)
+	case config.CapabilityHistoryWrite:
+		_, ok = server.(HistoryWriter)
+	case config.CapabilityRatings:
+		_, ok = server.(RatingsSync)
+	case config.CapabilityWatchlist:
+		_, ok = server.(WatchlistSource)
+	case config.CapabilityListMirror:
+		_, ok = server.(ListMirror)
+	case config.CapabilityLibrary:
+		_, ok = server.(LibrarySource)
+	case config.CapabilityCollection:
+		_, ok = server.(CollectionWriter)
+	case config.CapabilityResume:
+		_, ok = server.(ResumeWriter)
+	case config.CapabilityPlayed:
+		_, ok = server.(PlayedSource)
+	case config.CapabilityUnwatch:
+		_, ok = server.(UnwatchWriter)
+	case config.CapabilityPlayCount:
+		_, ok = server.(PlayCountWriter)
+	}
+	return ok
+}
+
+// Constructor creates a server from its configuration
+type Constructor func(name string, cfg config.Server) (Server, error)
+
+// Definition describes a server or target type
+type Definition struct {
+	config.ServerType
+	New Constructor
+}
+
+var (
+	definitions = make(map[config.ClientType]Definition)
+	lock        sync.RWMutex
+)
+
+// Register makes a server type available for construction, validation and the settings UI.
+// It is meant to be called from the init function of the package implementing the type.
+func Register(def Definition) {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, exists := definitions[def.Name]; exists {
+		panic(fmt.Sprintf("server type %s registered twice", def.Name))
+	}
+	definitions[def.Name] = def
+	config.RegisterServerType(def.ServerType)
+}
+
+// Get returns the definition of a server type
+func Get(name config.ClientType) (Definition, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	def, ok := definitions[name]
+	return def, ok
+}
+
+// New creates a server using the constructor registered for its type
+func New(name string, cfg config.Server) (Server, error) {
+	def, ok := Get(cfg.Type)
+	if !ok {
+		return nil, Permanent(fmt.Errorf("unsupported media server type: %s", cfg.Type))
+	}
+	server, err := def.New(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, capability := range def.Capabilities {
+		if !Supports(server, capability) {
+			return nil, Permanent(fmt.Errorf("server type %s declares %s but does not implement it", cfg.Type, capability))
+		}
+	}
+	return server, nil
+}
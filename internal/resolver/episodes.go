@@ -0,0 +1,227 @@
+package resolver
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/matcher"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"time"
+)
+
+// episodesTTL is how long the episode list of a show is kept, new episodes air every week
+const episodesTTL = 7 * 24 * time.Hour
+
+// episodeList is a cached episode list of a show
+type episodeList struct {
+	Episodes  []types.EpisodeNumbers `json:"episodes"`
+	ExpiresAt time.Time              `json:"expires_at"`
+}
+
+// Renumber converts the season and episode numbers of an episode from the episode order of the
+// server it comes from to the order of the server it is sent to, as set in the episode_orders config.
+// Episodes that cannot be converted are returned unchanged.
+func (r *Resolver) Renumber(session types.MediaSession, from, to string) types.MediaSession {
+	if session.Type != "episode" {
+		return session
+	}
+	fromOrder, toOrder := episodeOrder(session, from), episodeOrder(session, to)
+	if fromOrder == toOrder {
+		return session
+	}
+	episodes := r.episodes(session.ShowIDs)
+	if (fromOrder == config.EpisodeOrderDVD || toOrder == config.EpisodeOrderDVD) && !hasDVDNumbers(episodes) {
+		r.warnOnce("dvd:"+session.ShowTitle, "The episode list of %s has no DVD numbers, add them to the id_mapping file to renumber its episodes", session.ShowTitle)
+	}
+	numbers := toAired(session, fromOrder, episodes)
+	renumbered, ok := fromAired(session, numbers, toOrder)
+	if !ok {
+		r.logger.Debug().Msgf("Cannot number %s S%02dE%02d in %s order for %s",
+			session.ShowTitle, session.SeasonNum, session.EpisodeNum, toOrder, to)
+		return session
+	}
+	return renumbered
+}
+
+// episodeOrder returns the episode order a server uses for the show of an episode
+func episodeOrder(session types.MediaSession, server string) string {
+	for _, order := range config.Get().EpisodeOrders {
+		value, ok := order.Servers[server]
+		if !ok {
+			continue
+		}
+		switch {
+		case order.IMDB != "" || order.TVDB != "":
+			if (order.IMDB != "" && order.IMDB == session.ShowIDs.IMDB) ||
+				(order.TVDB != "" && order.TVDB == session.ShowIDs.TVDB) {
+				return value
+			}
+		case matcher.Normalize(order.Show) == matcher.Normalize(session.ShowTitle):
+			return value
+		}
+	}
+	return config.EpisodeOrderAired
+}
+
+// episodes lists the episodes of a show from the mapping file, or from a connected server
+// implementing EpisodeGuide, whose answers are cached on disk
+func (r *Resolver) episodes(show types.IDs) []types.EpisodeNumbers {
+	known := show.External()
+	if len(known) == 0 {
+		return nil
+	}
+	for _, id := range known {
+		if mapping, ok := r.mappings["show:"+id]; ok && len(mapping.Episodes) > 0 {
+			return mapping.Episodes
+		}
+	}
+
+	key := "episodes:" + known[0]
+	var cached episodeList
+	found, err := r.cache.Load(key, &cached)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Error reading episode cache")
+	}
+	if found && time.Now().Before(cached.ExpiresAt) {
+		return cached.Episodes
+	}
+	r.mu.Lock()
+	failed := time.Now().Before(r.failed[key])
+	r.mu.Unlock()
+	if failed {
+		return cached.Episodes
+	}
+	guide, name, ok := connected[media_servers.EpisodeGuide](r.servers)
+	if !ok {
+		return cached.Episodes
+	}
+	episodes, err := guide.GetEpisodes(show)
+	if err != nil {
+		// Keep using an expired list until the lookup works again
+		r.logger.Debug().Err(err).Msgf("Error listing episodes of %s on %s", key, name)
+		r.mu.Lock()
+		r.failed[key] = time.Now().Add(failedTTL)
+		r.mu.Unlock()
+		return cached.Episodes
+	}
+	ttl := episodesTTL
+	if len(episodes) == 0 {
+		ttl = notFoundTTL
+	}
+	cached = episodeList{Episodes: episodes, ExpiresAt: time.Now().Add(ttl)}
+	if err := r.cache.Save(key, cached); err != nil {
+		r.logger.Error().Err(err).Msg("Error saving episode cache")
+	}
+	return episodes
+}
+
+// toAired returns the numbers of an episode numbered in the given order. The aired
+// numbers are zero when the episode list of its show does not have it.
+func toAired(session types.MediaSession, order string, episodes []types.EpisodeNumbers) types.EpisodeNumbers {
+	numbers := types.EpisodeNumbers{Absolute: session.AbsoluteNum, AirDate: session.AirDate}
+	var match func(e types.EpisodeNumbers) bool
+	switch order {
+	case config.EpisodeOrderAired:
+		numbers.Season, numbers.Number = session.SeasonNum, session.EpisodeNum
+		match = func(e types.EpisodeNumbers) bool {
+			return e.Season == session.SeasonNum && e.Number == session.EpisodeNum
+		}
+	case config.EpisodeOrderAbsolute:
+		// Servers in absolute order list the count as the episode number
+		numbers.Absolute = session.EpisodeNum
+		match = func(e types.EpisodeNumbers) bool { return e.Absolute == session.EpisodeNum }
+	case config.EpisodeOrderDVD:
+		numbers.DVDSeason, numbers.DVDNumber = session.SeasonNum, session.EpisodeNum
+		match = func(e types.EpisodeNumbers) bool {
+			return e.DVDSeason == session.SeasonNum && e.DVDNumber == session.EpisodeNum
+		}
+	case config.EpisodeOrderDate:
+		match = func(e types.EpisodeNumbers) bool { return session.AirDate != "" && e.AirDate == session.AirDate }
+	default:
+		return numbers
+	}
+	for _, episode := range episodes {
+		if match(episode) {
+			return episode
+		}
+	}
+	if order == config.EpisodeOrderDate {
+		// Trakt dates episodes in UTC, so an evening broadcast in America falls on the next day
+		for _, episode := range episodes {
+			if daysApart(episode.AirDate, session.AirDate) == 1 {
+				return episode
+			}
+		}
+	}
+	return numbers
+}
+
+// daysApart returns how many days two YYYY-MM-DD dates are apart, or -1 if either is not a date
+func daysApart(a, b string) int {
+	x, err := time.Parse(time.DateOnly, a)
+	if err != nil {
+		return -1
+	}
+	y, err := time.Parse(time.DateOnly, b)
+	if err != nil {
+		return -1
+	}
+	days := int(x.Sub(y).Hours() / 24)
+	return max(days, -days)
+}
+
+// hasDVDNumbers reports whether an episode list knows the DVD order of its episodes
+func hasDVDNumbers(episodes []types.EpisodeNumbers) bool {
+	for _, episode := range episodes {
+		if episode.DVDNumber != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// warnOnce logs a warning the first time it is given for a key
+func (r *Resolver) warnOnce(key, format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.warned[key] {
+		return
+	}
+	r.warned[key] = true
+	r.logger.Warn().Msgf(format, args...)
+}
+
+// fromAired numbers an episode in the given order, and reports whether its numbers in that order are known
+func fromAired(session types.MediaSession, numbers types.EpisodeNumbers, order string) (types.MediaSession, bool) {
+	if numbers.Absolute != 0 {
+		session.AbsoluteNum = numbers.Absolute
+	}
+	if numbers.AirDate != "" {
+		session.AirDate = numbers.AirDate
+	}
+	switch order {
+	case config.EpisodeOrderAired:
+		if numbers.Number == 0 {
+			return session, false
+		}
+		session.SeasonNum, session.EpisodeNum = numbers.Season, numbers.Number
+	case config.EpisodeOrderAbsolute:
+		if numbers.Absolute == 0 {
+			return session, false
+		}
+		session.SeasonNum, session.EpisodeNum = 1, numbers.Absolute
+	case config.EpisodeOrderDVD:
+		if numbers.DVDNumber == 0 {
+			return session, false
+		}
+		session.SeasonNum, session.EpisodeNum = numbers.DVDSeason, numbers.DVDNumber
+	case config.EpisodeOrderDate:
+		// Targets match daily episodes on the air date
+		if session.AirDate == "" {
+			return session, false
+		}
+		if numbers.Number != 0 {
+			session.SeasonNum, session.EpisodeNum = numbers.Season, numbers.Number
+		}
+	}
+	return session, true
+}
@@ -0,0 +1,271 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"github.com/sirrobot01/scroblarr/pkg/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// foundTTL is how long looked up IDs are kept before asking again
+	foundTTL = 30 * 24 * time.Hour
+	// notFoundTTL is how long an unknown item is left alone
+	notFoundTTL = 24 * time.Hour
+	// failedTTL is how long a lookup that failed, e.g. while Trakt is down, is not tried again
+	failedTTL = 15 * time.Minute
+	// staleTTL is how long an expired entry is kept for an item that does not come back
+	staleTTL = 30 * 24 * time.Hour
+	// queueSize is how many lookups can wait, more are dropped and queued again when the item comes back
+	queueSize = 100
+)
+
+// errNoSource is returned when no server that can look up IDs is connected
+var errNoSource = errors.New("no ID lookup available")
+
+// Mapping is an entry of the ID mapping file, listing IDs known to belong to the same item,
+// and for a show optionally its episodes in each episode order
+type Mapping struct {
+	Type     string                 `json:"type"` // "movie", "show" or "episode"
+	IDs      types.IDs              `json:"ids"`
+	ShowIDs  types.IDs              `json:"show_ids,omitempty"`
+	Episodes []types.EpisodeNumbers `json:"episodes,omitempty"`
+}
+
+// entry is a cached lookup. Found is false for items the lookup did not know.
+type entry struct {
+	IDs       types.IDs `json:"ids"`
+	ShowIDs   types.IDs `json:"show_ids"`
+	Found     bool      `json:"found"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// lookupRequest is a queued lookup of the IDs of an item
+type lookupRequest struct {
+	key       string
+	mediaType string
+	ids       types.IDs
+}
+
+// Resolver fills in the external IDs a session is missing, so targets that only match on one kind
+// of ID still find items the source identifies by another. IDs come from a connected server implementing
+// IDResolver first, whose answers are cached on disk, then from the mapping file. Lookups run in the
+// background, so an item gets the looked up IDs once the answer is cached.
+type Resolver struct {
+	servers  *media_servers.Pool
+	mappings map[string]Mapping // By type and external ID, e.g. "show:anidb:69"
+	cache    *store.Store
+	queue    chan lookupRequest
+	pending  map[string]bool      // Lookups queued or running, by cache key
+	failed   map[string]time.Time // When failed lookups can be tried again, by cache key
+	warned   map[string]bool
+	mu       sync.Mutex
+	logger   zerolog.Logger
+}
+
+// New creates a resolver looking up IDs through the servers of the pool
+func New(servers *media_servers.Pool) *Resolver {
+	cfg := config.Get()
+	r := &Resolver{
+		servers:  servers,
+		mappings: make(map[string]Mapping),
+		cache:    store.New(filepath.Join(cfg.Path, "ids.json")),
+		queue:    make(chan lookupRequest, queueSize),
+		pending:  make(map[string]bool),
+		failed:   make(map[string]time.Time),
+		warned:   make(map[string]bool),
+		logger:   logger.NewLogger("resolver"),
+	}
+	if path := cfg.GetIDMappingPath(); path != "" {
+		if err := r.loadMappings(path); err != nil {
+			r.logger.Error().Err(err).Msg("Error loading ID mapping, continuing without it")
+		}
+	}
+	r.prune()
+	go r.run()
+	return r
+}
+
+// prune removes the cached lookups and episode lists of items not seen since long after they expired.
+// An expired entry is otherwise kept until the lookup of its item replaces it.
+func (r *Resolver) prune() {
+	stale := time.Now().Add(-staleTTL)
+	removed, err := r.cache.Prune(func(key string, value json.RawMessage) bool {
+		var cached entry
+		return json.Unmarshal(value, &cached) == nil && cached.ExpiresAt.After(stale)
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Error pruning ID cache")
+	} else if removed > 0 {
+		r.logger.Debug().Msgf("Removed %d stale IDs from the cache", removed)
+	}
+}
+
+// loadMappings reads the mapping file, a JSON array of mappings
+func (r *Resolver) loadMappings(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var mappings []Mapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, mapping := range mappings {
+		for _, id := range mapping.IDs.External() {
+			r.mappings[mapping.Type+":"+id] = mapping
+		}
+	}
+	r.logger.Debug().Msgf("Loaded %d ID mappings", len(mappings))
+	return nil
+}
+
+// Resolve returns the session with the missing IDs of the item, and of its show for an episode, filled in.
+// Sessions that cannot be resolved are returned unchanged.
+func (r *Resolver) Resolve(session types.MediaSession) types.MediaSession {
+	switch session.Type {
+	case "movie", "show", "episode":
+	default:
+		return session
+	}
+	if !complete(session.Type, session.IDs) {
+		ids, show := r.resolve(session.Type, session.IDs)
+		session.IDs.Merge(ids)
+		session.ShowIDs.Merge(show)
+	}
+	if session.Type == "episode" && !complete("show", session.ShowIDs) {
+		show, _ := r.resolve("show", session.ShowIDs)
+		session.ShowIDs.Merge(show)
+	}
+	return session
+}
+
+// resolve returns the IDs of an item from the cached lookups and then the mapping file. Items missing
+// from the cache, or whose entry expired, are queued for a lookup.
+func (r *Resolver) resolve(mediaType string, ids types.IDs) (types.IDs, types.IDs) {
+	known := ids.External()
+	if len(known) == 0 {
+		return types.IDs{}, types.IDs{}
+	}
+	var show types.IDs
+	key := mediaType + ":" + known[0]
+	var cached entry
+	found, err := r.cache.Load(key, &cached)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Error reading ID cache")
+	}
+	if !found || time.Now().After(cached.ExpiresAt) {
+		// An expired entry is used until the lookup replaces it
+		r.enqueue(lookupRequest{key: key, mediaType: mediaType, ids: ids})
+	}
+	if cached.Found {
+		ids.Merge(cached.IDs)
+		show.Merge(cached.ShowIDs)
+	}
+	// The mapping file fills in what the lookup does not know
+	for _, id := range known {
+		if mapping, ok := r.mappings[mediaType+":"+id]; ok {
+			ids.Merge(mapping.IDs)
+			show.Merge(mapping.ShowIDs)
+		}
+	}
+	return ids, show
+}
+
+// enqueue queues a lookup, unless it is already queued or failed recently
+func (r *Resolver) enqueue(request lookupRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[request.key] || time.Now().Before(r.failed[request.key]) {
+		return
+	}
+	select {
+	case r.queue <- request:
+		r.pending[request.key] = true
+	default:
+		// Queued again when the item comes back
+	}
+}
+
+// run performs the queued lookups one at a time and caches the answers
+func (r *Resolver) run() {
+	for request := range r.queue {
+		fresh, err := r.lookup(request.mediaType, request.ids)
+		r.mu.Lock()
+		delete(r.pending, request.key)
+		switch {
+		case errors.Is(err, errNoSource):
+			// Not a failure of the lookup, it runs as soon as a source is connected
+		case err != nil:
+			r.failed[request.key] = time.Now().Add(failedTTL)
+		default:
+			delete(r.failed, request.key)
+		}
+		r.mu.Unlock()
+
+		switch {
+		case errors.Is(err, errNoSource):
+			// Try again once a source is connected
+		case err != nil:
+			r.logger.Debug().Err(err).Msgf("Error looking up IDs for %s", request.key)
+		default:
+			if err := r.cache.Save(request.key, fresh); err != nil {
+				r.logger.Error().Err(err).Msg("Error saving ID cache")
+			}
+		}
+	}
+}
+
+// lookup asks the first connected server able to look up IDs
+func (r *Resolver) lookup(mediaType string, ids types.IDs) (entry, error) {
+	source, name, ok := connected[media_servers.IDResolver](r.servers)
+	if !ok {
+		return entry{}, errNoSource
+	}
+	found, show, ok, err := source.SearchIDs(mediaType, ids)
+	if err != nil {
+		return entry{}, err
+	}
+	if !ok {
+		r.logger.Debug().Msgf("%s does not know %s %v", name, mediaType, ids.External())
+		return entry{ExpiresAt: time.Now().Add(notFoundTTL)}, nil
+	}
+	return entry{
+		IDs:       found,
+		ShowIDs:   show,
+		Found:     true,
+		ExpiresAt: time.Now().Add(foundTTL),
+	}, nil
+}
+
+// connected returns the first connected server of the pool implementing T, and its name
+func connected[T any](servers *media_servers.Pool) (T, string, bool) {
+	for _, name := range servers.Names() {
+		server, ok := servers.Get(name)
+		if !ok {
+			continue
+		}
+		if capable, ok := server.(T); ok {
+			return capable, name, true
+		}
+	}
+	var none T
+	return none, "", false
+}
+
+// complete reports whether an item has every ID targets match on, so there is nothing to look up
+func complete(mediaType string, ids types.IDs) bool {
+	if ids.IMDB == "" || ids.TMDB == "" {
+		return false
+	}
+	return mediaType == "movie" || ids.TVDB != ""
+}
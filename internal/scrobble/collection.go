@@ -0,0 +1,248 @@
+package scrobble
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"time"
+)
+
+const (
+	// collectionInterval is how often syncs with collection enabled check the source's libraries for changes
+	collectionInterval = time.Hour
+	// collectionFullInterval is how often every library is read again, to catch removals the server does not date
+	collectionFullInterval = 24 * time.Hour
+)
+
+// collectionState is what the targets' collections hold of the source's libraries
+type collectionState struct {
+	FullSyncAt int64                   `json:"full_sync_at"`
+	Libraries  map[string]libraryState `json:"libraries"`
+}
+
+// libraryState is a library as of the last sync
+type libraryState struct {
+	UpdatedAt int64                    `json:"updated_at"`
+	Items     map[string]collectedItem `json:"items"`
+}
+
+// collectedItem is the part of a library item needed to remove it from a collection again
+type collectedItem struct {
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Year      int       `json:"year,omitempty"`
+	IDs       types.IDs `json:"ids"`
+	ShowIDs   types.IDs `json:"show_ids"`
+	ShowTitle string    `json:"show,omitempty"`
+	Season    int       `json:"season,omitempty"`
+	Episode   int       `json:"episode,omitempty"`
+}
+
+func newCollectedItem(item types.LibraryItem) collectedItem {
+	return collectedItem{
+		Type:      item.Session.Type,
+		Title:     item.Session.Title,
+		Year:      item.Session.Year,
+		IDs:       item.Session.IDs,
+		ShowIDs:   item.Session.ShowIDs,
+		ShowTitle: item.Session.ShowTitle,
+		Season:    item.Session.SeasonNum,
+		Episode:   item.Session.EpisodeNum,
+	}
+}
+
+func (c collectedItem) libraryItem() types.LibraryItem {
+	return types.LibraryItem{Session: types.MediaSession{
+		Type:       c.Type,
+		Title:      c.Title,
+		Year:       c.Year,
+		IDs:        c.IDs,
+		ShowIDs:    c.ShowIDs,
+		ShowTitle:  c.ShowTitle,
+		SeasonNum:  c.Season,
+		EpisodeNum: c.Episode,
+	}}
+}
+
+// syncCollection adds the movies and episodes added to the source's libraries since the last run
+// to the targets' collections, and removes those that left. Unchanged libraries are skipped.
+func (s *Sync) syncCollection(server media_servers.Server) {
+	source, ok := server.(media_servers.LibrarySource)
+	if !ok {
+		s.logger.Error().Msgf("Source server %s cannot list its libraries, disabling collection sync", s.source)
+		s.collection = false
+		return
+	}
+	targets := s.getCollectionWriters()
+	if len(targets) < len(s.targets) {
+		// A missing target would miss the changes for good
+		s.logger.Debug().Msg("Some targets are not connected, postponing collection sync")
+		return
+	}
+	libraries, err := source.GetLibraries()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error getting libraries")
+		return
+	}
+
+	key := s.stateKey("collection:" + s.name)
+	var state collectionState
+	found, err := collectionStore().Load(key, &state)
+	if err == nil && !found {
+		// Older versions kept it in state.json
+		_, err = store.Get().Load(key, &state)
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error loading collection sync state")
+		return
+	}
+	if state.Libraries == nil {
+		state.Libraries = make(map[string]libraryState)
+	}
+	full := time.Since(time.Unix(state.FullSyncAt, 0)) >= collectionFullInterval
+
+	seen := make(map[string]bool, len(libraries))
+	complete := true
+	for _, library := range libraries {
+		if library.Type != "movie" && library.Type != "show" {
+			continue
+		}
+		seen[library.ID] = true
+		previous, ok := state.Libraries[library.ID]
+		if ok && !full && library.UpdatedAt == previous.UpdatedAt {
+			continue
+		}
+		items, err := source.GetLibraryItems(library)
+		if err != nil {
+			s.logger.Error().Err(err).Msgf("Error getting items of %s", library.Name)
+			complete = false
+			continue
+		}
+
+		current := make(map[string]collectedItem, len(items))
+		added := make([]types.LibraryItem, 0)
+		for _, item := range items {
+			itemKey := types.GetMediaKey(item.Session)
+			current[itemKey] = newCollectedItem(item)
+			if _, ok := previous.Items[itemKey]; !ok {
+				added = append(added, item)
+			}
+		}
+		removed := make([]types.LibraryItem, 0)
+		for itemKey, item := range previous.Items {
+			if _, ok := current[itemKey]; !ok && !state.owned(itemKey, library.ID) {
+				removed = append(removed, item.libraryItem())
+			}
+		}
+		if !s.updateCollections(targets, library.Name, added, removed) {
+			complete = false
+			continue
+		}
+		state.Libraries[library.ID] = libraryState{UpdatedAt: library.UpdatedAt, Items: current}
+	}
+
+	// Items of deleted libraries leave the collections too
+	for id, library := range state.Libraries {
+		if seen[id] {
+			continue
+		}
+		removed := make([]types.LibraryItem, 0, len(library.Items))
+		for itemKey, item := range library.Items {
+			if !state.owned(itemKey, id) {
+				removed = append(removed, item.libraryItem())
+			}
+		}
+		if s.updateCollections(targets, "a removed library", nil, removed) {
+			delete(state.Libraries, id)
+		}
+	}
+
+	if full && complete {
+		state.FullSyncAt = time.Now().Unix()
+	}
+	if err := collectionStore().Save(key, state); err != nil {
+		s.logger.Error().Err(err).Msg("Error saving collection sync state")
+		return
+	}
+	if err := store.Get().Delete(key); err != nil {
+		s.logger.Error().Err(err).Msg("Error removing the old collection sync state")
+	}
+}
+
+// owned reports whether a library other than the one with the given ID holds an item, so the
+// item stays in the collections when it leaves that library
+func (c collectionState) owned(itemKey, except string) bool {
+	for id, library := range c.Libraries {
+		if _, ok := library.Items[itemKey]; ok && id != except {
+			return true
+		}
+	}
+	return false
+}
+
+// collectionStore keeps the collection sync state, which lists whole libraries, out of state.json
+func collectionStore() *store.Store {
+	return store.Named("collection")
+}
+
+// updateCollections sends the changes of a library to every target, reporting whether all succeeded
+func (s *Sync) updateCollections(targets []media_servers.CollectionWriter, library string, added, removed []types.LibraryItem) bool {
+	if len(added) == 0 && len(removed) == 0 {
+		return true
+	}
+	ok := true
+	for _, target := range targets {
+		added, removed := s.renumberItems(added, target.GetName()), s.renumberItems(removed, target.GetName())
+		if s.dryRun {
+			for _, item := range added {
+				s.preview(target, item.Session, "collect")
+			}
+			for _, item := range removed {
+				s.preview(target, item.Session, "uncollect")
+			}
+			continue
+		}
+		if err := target.AddToCollection(added); err != nil {
+			s.logger.Error().Err(err).Msgf("Error adding %s to the %s collection", library, target.GetName())
+			ok = false
+			continue
+		}
+		if err := target.RemoveFromCollection(removed); err != nil {
+			s.logger.Error().Err(err).Msgf("Error removing items of %s from the %s collection", library, target.GetName())
+			ok = false
+		}
+	}
+	if ok && !s.dryRun {
+		s.logger.Info().Msgf("Collection updated from %s: %d added, %d removed", library, len(added), len(removed))
+	}
+	return ok
+}
+
+// renumberItems converts the episode numbers of library items to the episode orders of a target
+func (s *Sync) renumberItems(items []types.LibraryItem, target string) []types.LibraryItem {
+	renumbered := make([]types.LibraryItem, len(items))
+	for i, item := range items {
+		item.Session = s.resolver.Renumber(item.Session, s.source, target)
+		renumbered[i] = item
+	}
+	return renumbered
+}
+
+// getCollectionWriters returns the targets that are connected and keep a collection
+func (s *Sync) getCollectionWriters() []media_servers.CollectionWriter {
+	targets := make([]media_servers.CollectionWriter, 0, len(s.targets))
+	for _, name := range s.targets {
+		server, ok := s.servers.Get(name)
+		if !ok {
+			s.logger.Debug().Msgf("Target %s is not connected, skipping it", name)
+			continue
+		}
+		target, ok := server.(media_servers.CollectionWriter)
+		if !ok {
+			s.logger.Error().Msgf("Target server %s does not keep a collection, skipping it", name)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
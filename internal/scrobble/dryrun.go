@@ -0,0 +1,67 @@
+package scrobble
+
+import (
+	"errors"
+	"github.com/sirrobot01/scroblarr/internal/ledger"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// preview records in the ledger what a write to a target would send in a dry run, or why it would not
+// be sent. Progress updates of playing sessions are left out, they repeat every interval.
+func (s *Sync) preview(target media_servers.Server, session types.MediaSession, action string) {
+	if action == "start" || action == "pause" {
+		return
+	}
+	entry := s.dryRunEntry(session, target.GetName(), action)
+	entry.Status = ledger.StatusWouldSend
+	if previewer, ok := target.(media_servers.Previewer); ok {
+		detail, err := previewer.Preview(session, action)
+		switch {
+		case errors.Is(err, media_servers.ErrUnsupported):
+			entry.Status = ledger.StatusFiltered
+			entry.Error = err.Error()
+		case err != nil:
+			entry.Status = ledger.StatusNotFound
+			entry.Error = err.Error()
+		}
+		entry.Detail = detail
+	}
+	s.logger.Debug().Msgf("[%s] Dry run: %s %s (%s)", target.GetName(), action, session.Title, entry.Status)
+	if err := ledger.Get().Record(entry); err != nil {
+		s.logger.Error().Err(err).Msg("Error recording dry run")
+	}
+}
+
+// filter records in the ledger a write a dry run leaves out on purpose
+func (s *Sync) filter(session types.MediaSession, target, action, reason string) {
+	if !s.dryRun {
+		return
+	}
+	entry := s.dryRunEntry(session, target, action)
+	entry.Status = ledger.StatusFiltered
+	entry.Error = reason
+	if err := ledger.Get().Record(entry); err != nil {
+		s.logger.Error().Err(err).Msg("Error recording dry run")
+	}
+}
+
+func (s *Sync) dryRunEntry(session types.MediaSession, target, action string) ledger.Entry {
+	return ledger.Entry{
+		Sync:    s.name,
+		Source:  s.source,
+		Target:  target,
+		Action:  action,
+		Session: session,
+		DryRun:  true,
+	}
+}
+
+// stateKey is where a sync keeps its progress in the store. Dry runs keep theirs apart, so turning
+// dry run off later still sends everything it only recorded.
+func (s *Sync) stateKey(key string) string {
+	if s.dryRun {
+		return key + ":dry_run"
+	}
+	return key
+}
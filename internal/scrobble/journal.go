@@ -0,0 +1,103 @@
+package scrobble
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"sync"
+	"time"
+)
+
+const (
+	// journalTTL is how long a write to a server is remembered, longer than the syncs take to read
+	// their history and watched items back
+	journalTTL = 30 * time.Minute
+	// journalRefresh is how old an entry gets before the same write renews it, so the progress
+	// reports of a playing session do not rewrite the journal file every poll
+	journalRefresh = time.Minute
+	// journalKey is where the journal is kept in its store
+	journalKey = "writes"
+)
+
+// journalEntry is a write to a server, with the server the change first came from
+type journalEntry struct {
+	Origin string    `json:"origin"`
+	At     time.Time `json:"at"`
+}
+
+// writeJournal remembers the writes of every sync for a short while, so a sync whose source
+// was just written to by another one does not copy the change back where it came from. Plex
+// records Scroblarr's writes without any tag, so for Plex sources the journal is the only guard.
+// It is kept in a store, when given one, so it still holds the recent writes after a restart.
+type writeJournal struct {
+	entries map[string]journalEntry
+	store   *store.Store
+	mu      sync.Mutex
+}
+
+// newWriteJournal loads the journal kept in s, or starts an empty one kept in memory if s is nil
+func newWriteJournal(s *store.Store) (*writeJournal, error) {
+	j := &writeJournal{entries: make(map[string]journalEntry), store: s}
+	if s == nil {
+		return j, nil
+	}
+	if _, err := s.Load(journalKey, &j.entries); err != nil {
+		return j, err
+	}
+	j.expire(time.Now())
+	return j, nil
+}
+
+// add remembers that a change to an item, first made on origin, was written to a server
+func (j *writeJournal) add(server, origin string, session types.MediaSession) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	changed := j.expire(now)
+	for _, key := range journalKeys(session) {
+		entry, ok := j.entries[server+"|"+key]
+		if ok && entry.Origin == origin && now.Sub(entry.At) < journalRefresh {
+			continue
+		}
+		j.entries[server+"|"+key] = journalEntry{Origin: origin, At: now}
+		changed = true
+	}
+	if !changed || j.store == nil {
+		return nil
+	}
+	return j.store.Save(journalKey, j.entries)
+}
+
+// expire removes the entries older than journalTTL, reporting whether there were any. The caller
+// must hold j.mu, unless the journal is not shared yet.
+func (j *writeJournal) expire(now time.Time) bool {
+	var expired bool
+	for key, entry := range j.entries {
+		if now.Sub(entry.At) > journalTTL {
+			delete(j.entries, key)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// origin returns the server a recent write of an item to server came from, or "" if there was none
+func (j *writeJournal) origin(server string, session types.MediaSession) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, key := range journalKeys(session) {
+		if entry, ok := j.entries[server+"|"+key]; ok && time.Since(entry.At) <= journalTTL {
+			return entry.Origin
+		}
+	}
+	return ""
+}
+
+// journalKeys identifies an item by each of its external IDs, since a server reading an item back may
+// know it by other IDs than the one it was written with. Items without any are identified by their
+// titles, which other items can share.
+func journalKeys(session types.MediaSession) []string {
+	if keys := session.IDs.Keys(session.Type); len(keys) > 0 {
+		return keys
+	}
+	return []string{types.GetMediaKey(session)}
+}
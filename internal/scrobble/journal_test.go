@@ -0,0 +1,57 @@
+package scrobble
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteJournalOrigin(t *testing.T) {
+	lost := types.MediaSession{Type: "episode", Title: "Pilot", ShowTitle: "Lost", SeasonNum: 1, EpisodeNum: 1, IDs: types.IDs{TVDB: "127131"}}
+	journal, _ := newWriteJournal(nil)
+	_ = journal.add("plex", "jellyfin", lost)
+	_ = journal.add("plex", "emby", types.MediaSession{Type: "movie", Title: "Alien", Year: 1979})
+
+	tests := []struct {
+		name    string
+		server  string
+		session types.MediaSession
+		want    string
+	}{
+		{"same item", "plex", lost, "jellyfin"},
+		{"same ID under another title", "plex", types.MediaSession{Type: "episode", Title: "Pilot (1)", IDs: types.IDs{TVDB: "127131"}}, "jellyfin"},
+		{"other server", "emby", lost, ""},
+		{"same ID of another type", "plex", types.MediaSession{Type: "movie", Title: "Lost", IDs: types.IDs{TVDB: "127131"}}, ""},
+		{"another show's pilot", "plex", types.MediaSession{Type: "episode", Title: "Pilot", ShowTitle: "Fringe", SeasonNum: 1, EpisodeNum: 1, IDs: types.IDs{TVDB: "336271"}}, ""},
+		{"item without IDs by title", "plex", types.MediaSession{Type: "movie", Title: "Alien", Year: 1979}, "emby"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := journal.origin(tt.server, tt.session); got != tt.want {
+				t.Errorf("origin() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJournalRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	alien := types.MediaSession{Type: "movie", Title: "Alien", Year: 1979, IDs: types.IDs{TMDB: "348"}}
+	journal, err := newWriteJournal(store.New(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.add("plex", "jellyfin", alien); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plex tags nothing Scroblarr writes, so after a restart only the saved journal knows the origin
+	restarted, err := newWriteJournal(store.New(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.origin("plex", alien); got != "jellyfin" {
+		t.Errorf("origin() after a restart = %q, want %q", got, "jellyfin")
+	}
+}
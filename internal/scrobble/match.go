@@ -0,0 +1,34 @@
+package scrobble
+
+import "github.com/sirrobot01/scroblarr/internal/types"
+
+// mediaIndex finds the same movie, show or episode among the items of another server
+type mediaIndex struct {
+	byID  map[string]int
+	byKey map[string]int
+}
+
+func newMediaIndex(items []types.MediaSession) mediaIndex {
+	index := mediaIndex{
+		byID:  make(map[string]int, len(items)),
+		byKey: make(map[string]int, len(items)),
+	}
+	for i, item := range items {
+		index.byKey[types.GetMediaKey(item)] = i
+		for _, id := range item.IDs.Keys(item.Type) {
+			index.byID[id] = i
+		}
+	}
+	return index
+}
+
+// find returns the position of item, matching on external IDs first and then on the titles
+func (m mediaIndex) find(item types.MediaSession) (int, bool) {
+	for _, id := range item.IDs.Keys(item.Type) {
+		if i, ok := m.byID[id]; ok {
+			return i, true
+		}
+	}
+	i, ok := m.byKey[types.GetMediaKey(item)]
+	return i, ok
+}
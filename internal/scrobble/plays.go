@@ -0,0 +1,124 @@
+package scrobble
+
+import (
+	"errors"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"time"
+)
+
+const (
+	// playCountsInterval is how often syncs reconciling play counts compare their servers
+	playCountsInterval = time.Hour
+	// playedAtTolerance is how far apart two last played dates can be and still count as the same,
+	// servers store them with different precision
+	playedAtTolerance = int64(time.Minute / time.Second)
+)
+
+// syncPlayCounts brings the play count and last played date of every watched item of the source to the
+// targets. Targets ahead of the source, e.g. from plays of their own, are left alone.
+func (s *Sync) syncPlayCounts(server media_servers.Server) {
+	source, ok := server.(media_servers.PlayedSource)
+	if !ok {
+		s.logger.Error().Msgf("Source server %s cannot list watched items, disabling play count sync", s.source)
+		s.playCounts = false
+		return
+	}
+	targets := make([]media_servers.PlayCountWriter, 0, len(s.targets))
+	for _, name := range s.targets {
+		target, ok := s.servers.Get(name)
+		if !ok {
+			// Try again later rather than missing the targets that are down
+			s.logger.Debug().Msgf("%s is not connected, postponing play count sync", name)
+			return
+		}
+		writer, ok := target.(media_servers.PlayCountWriter)
+		if !ok {
+			s.logger.Error().Msgf("Target server %s cannot add plays, skipping it", name)
+			continue
+		}
+		targets = append(targets, writer)
+	}
+	played, err := source.GetPlayed()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error getting watched items")
+		return
+	}
+
+	for _, target := range targets {
+		theirs, err := target.GetPlayed()
+		if err != nil {
+			s.logger.Error().Err(err).Msgf("Error getting watched items from %s", target.GetName())
+			continue
+		}
+		key := s.stateKey("plays:" + s.name + ":" + target.GetName())
+		state := make(map[string]playsState)
+		if _, err := store.Named("plays").Load(key, &state); err != nil {
+			s.logger.Error().Err(err).Msg("Error loading play count sync state")
+			continue
+		}
+		index := newMediaIndex(theirs)
+		var updated int
+		for _, item := range played {
+			var have int
+			var playedAt int64
+			if i, ok := index.find(item); ok {
+				have, playedAt = max(theirs[i].PlayCount, 1), theirs[i].ViewedAt
+			}
+			// The target's copy may not be found again, so what was already written counts too
+			written := state[playedKey(item)]
+			have, playedAt = max(have, written.Plays), max(playedAt, written.PlayedAt)
+			missing := max(item.PlayCount, 1) - have
+			if missing <= 0 && item.ViewedAt <= playedAt+playedAtTolerance {
+				continue
+			}
+			written, ok := s.addPlays(target, item, max(missing, 0))
+			if ok {
+				state[playedKey(item)] = written
+				if missing > 0 {
+					updated++
+				}
+			}
+		}
+		if updated > 0 {
+			s.logger.Info().Msgf("Updated the play counts of %d items on %s", updated, target.GetName())
+		}
+		if err := store.Named("plays").Save(key, state); err != nil {
+			s.logger.Error().Err(err).Msg("Error saving play count sync state")
+		}
+	}
+}
+
+// addPlays adds the plays a target is missing of an item, or moves its last played date. It returns
+// the play count and date the target has been brought to, and false if the write failed.
+func (s *Sync) addPlays(target media_servers.PlayCountWriter, item types.MediaSession, plays int) (playsState, bool) {
+	item.Source = s.source
+	written := playsState{Plays: max(item.PlayCount, 1), PlayedAt: item.ViewedAt}
+	item = s.resolver.Resolve(item)
+	if s.dryRun {
+		if plays > 0 {
+			s.preview(target, s.resolver.Renumber(item, s.source, target.GetName()), "play_count")
+		}
+		return written, true
+	}
+	err := target.AddPlays(s.resolver.Renumber(item, s.source, target.GetName()), plays)
+	switch {
+	case errors.Is(err, media_servers.ErrUnsupported):
+		// The server cannot move a last played date, so it is not tried again
+		s.logger.Trace().Err(err).Msgf("[%s] Not moving the last played date of %s", target.GetName(), item.Title)
+		return written, true
+	case err != nil:
+		s.logger.Error().Err(err).Msgf("Error adding plays of %s to %s", item.Title, target.GetName())
+	default:
+		s.logger.Trace().Msgf("[%s] Added %d plays of %s", target.GetName(), plays, item.Title)
+	}
+	s.record(item, target.GetName(), "play_count", err)
+	return written, err == nil
+}
+
+// playsState is the play count and last played date a sync brought a target's copy of an item to
+type playsState struct {
+	Plays    int   `json:"plays"`
+	PlayedAt int64 `json:"played_at"`
+}
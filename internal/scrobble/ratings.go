@@ -0,0 +1,169 @@
+package scrobble
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/ledger"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"time"
+)
+
+// ratingsInterval is how often syncs with ratings enabled compare the ratings of their servers
+const ratingsInterval = 15 * time.Minute
+
+// ratingState is what a sync last saw of a rating, for servers that do not record when items were rated
+type ratingState struct {
+	Value  int   `json:"value"`
+	SeenAt int64 `json:"seen_at"` // When the value was first seen or written, 0 if it predates the sync
+}
+
+// serverRatings are the ratings of one server, indexed to find the same item on another server
+type serverRatings struct {
+	server  media_servers.RatingsSync
+	ratings []types.Rating
+	index   mediaIndex
+	state   map[string]ratingState
+}
+
+// find returns the rating of the item of another server's rating
+func (r *serverRatings) find(rating types.Rating) (types.Rating, bool) {
+	if i, ok := r.index.find(rating.Session); ok {
+		return r.ratings[i], true
+	}
+	return types.Rating{}, false
+}
+
+// syncRatings copies ratings from the source to the targets. With two-way sync the ratings of
+// every server are copied to every other one, targets included. When an item is rated differently
+// on two servers, the newest rating wins.
+func (s *Sync) syncRatings() {
+	servers := make([]*serverRatings, 0, len(s.targets)+1)
+	for _, name := range append([]string{s.source}, s.targets...) {
+		server, ok := s.servers.Get(name)
+		if !ok {
+			// Try again later, a missing server would look like it has no ratings
+			s.logger.Debug().Msgf("%s is not connected, postponing ratings sync", name)
+			return
+		}
+		rs, ok := server.(media_servers.RatingsSync)
+		if !ok {
+			s.logger.Error().Msgf("Server %s does not support ratings, disabling ratings sync", name)
+			s.ratings = ""
+			return
+		}
+		ratings, err := s.loadRatings(rs)
+		if err != nil {
+			s.logger.Error().Err(err).Msgf("Error getting ratings from %s", name)
+			return
+		}
+		servers = append(servers, ratings)
+	}
+
+	from := servers[:1]
+	if s.ratings == config.RatingsTwoWay {
+		from = servers
+	}
+	for i, server := range from {
+		for _, rating := range server.ratings {
+			// Only the winning rating of an item is copied, so the servers do not overwrite each other
+			if s.ratings == config.RatingsTwoWay && outrated(servers, i, rating) {
+				continue
+			}
+			for j, target := range servers {
+				if j == i {
+					continue
+				}
+				renumbered := rating
+				renumbered.Session = s.resolver.Renumber(rating.Session, server.server.GetName(), target.server.GetName())
+				if other, ok := target.find(renumbered); !ok || (other.Value != rating.Value && rating.RatedAt > other.RatedAt) {
+					s.setRating(target, renumbered)
+				}
+			}
+		}
+	}
+
+	for _, server := range servers {
+		if err := store.Get().Save(s.stateKey(ratingsKey(s.name, server.server.GetName())), server.state); err != nil {
+			s.logger.Error().Err(err).Msg("Error saving ratings sync state")
+		}
+	}
+}
+
+// outrated reports whether another server rated the item of the i-th server's rating differently and
+// later, or at the same time while coming first in the sync
+func outrated(servers []*serverRatings, i int, rating types.Rating) bool {
+	for j, server := range servers {
+		if j == i {
+			continue
+		}
+		other, ok := server.find(rating)
+		if ok && other.Value != rating.Value && (other.RatedAt > rating.RatedAt || (other.RatedAt == rating.RatedAt && j < i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRatings gets the ratings of a server. Ratings without a time get the time they were first seen.
+func (s *Sync) loadRatings(server media_servers.RatingsSync) (*serverRatings, error) {
+	ratings, err := server.GetRatings()
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[string]ratingState)
+	if _, err := store.Get().Load(s.stateKey(ratingsKey(s.name, server.GetName())), &previous); err != nil {
+		return nil, err
+	}
+
+	r := &serverRatings{
+		server:  server,
+		ratings: ratings,
+		state:   make(map[string]ratingState, len(ratings)),
+	}
+	now := time.Now().Unix()
+	for i, rating := range ratings {
+		key := types.GetMediaKey(rating.Session)
+		if rating.RatedAt == 0 {
+			state, ok := previous[key]
+			switch {
+			case ok && state.Value == rating.Value:
+				rating.RatedAt = state.SeenAt
+			case ok || len(previous) > 0:
+				// Rated since the last sync
+				rating.RatedAt = now
+			}
+			// Ratings present before the first sync keep 0, so servers that know the time win
+		}
+		r.ratings[i] = rating
+		r.state[key] = ratingState{Value: rating.Value, SeenAt: rating.RatedAt}
+	}
+	sessions := make([]types.MediaSession, len(ratings))
+	for i, rating := range ratings {
+		sessions[i] = rating.Session
+	}
+	r.index = newMediaIndex(sessions)
+	return r, nil
+}
+
+// setRating writes a rating to a server and records it
+func (s *Sync) setRating(target *serverRatings, rating types.Rating) {
+	name := target.server.GetName()
+	if s.dryRun {
+		s.preview(target.server, rating.Session, "rate")
+		return
+	}
+	err := target.server.SetRating(rating)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("Error rating %s in %s", rating.Session.Title, name)
+	} else {
+		s.logger.Debug().Msgf("[%s] Rated %s %d/10", name, rating.Session.Title, rating.Value)
+		// The written rating is as old as the one it was copied from
+		target.state[types.GetMediaKey(rating.Session)] = ratingState{Value: rating.Value, SeenAt: rating.RatedAt}
+	}
+	s.recordEntry(ledger.Entry{Target: name, Action: "rate", Session: rating.Session, Rating: rating.Value}, err)
+}
+
+func ratingsKey(sync, server string) string {
+	return "ratings:" + sync + ":" + server
+}
@@ -1,24 +1,61 @@
 package scrobble
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/ledger"
 	"github.com/sirrobot01/scroblarr/internal/media_servers"
-	"github.com/sirrobot01/scroblarr/internal/trakt"
+	"github.com/sirrobot01/scroblarr/internal/resolver"
+	"github.com/sirrobot01/scroblarr/internal/store"
 	"github.com/sirrobot01/scroblarr/internal/types"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
+	"sort"
 	"sync"
 	"time"
 )
 
+// historyInterval is how often syncs with history enabled look for new plays on the source
+const historyInterval = 5 * time.Minute
+
+// errNotFound marks plays a target could not match, recorded with their own ledger status
+var errNotFound = media_servers.ErrNotFound
+
+// Sink receives every session state change seen by the syncs, e.g. to publish it to MQTT
+type Sink interface {
+	Publish(server string, session types.MediaSession, action string) error
+}
+
 type Sync struct {
-	source   media_servers.Server
-	targets  []media_servers.Server
-	trakt    *trakt.Client
-	interval time.Duration
-	logger   zerolog.Logger
-	sessions *types.MediaSessionHistory
+	name       string
+	sinks      []Sink
+	servers    *media_servers.Pool
+	resolver   *resolver.Resolver
+	source     string
+	targets    []string
+	interval   time.Duration
+	history    bool
+	ratings    string
+	watchlist  *config.Watchlist
+	collection bool
+	resume     time.Duration // Minimum resume position copied to the targets, 0 when off
+	unwatched  bool
+	playCounts bool
+	dryRun     bool // Record the writes to the targets instead of sending them
+	journal    *writeJournal
+	logger     zerolog.Logger
+	sessions   *types.MediaSessionHistory
+
+	lastHistorySync    time.Time
+	lastRatingsSync    time.Time
+	lastWatchlistSync  time.Time
+	lastCollectionSync time.Time
+	lastUnwatchedSync  time.Time
+	lastPlayCountSync  time.Time
 }
 
 type Scrobble struct {
@@ -27,41 +64,36 @@ type Scrobble struct {
 	logger    zerolog.Logger
 }
 
-func New(servers map[string]media_servers.Server) (*Scrobble, error) {
+func New(servers *media_servers.Pool, sinks ...Sink) (*Scrobble, error) {
 	cfg := config.Get()
 	_logger := logger.NewLogger("scrobble")
-	traktClient := trakt.New()
 
+	for _, warning := range cfg.Warnings() {
+		_logger.Warn().Msg(warning)
+	}
+
+	ids := resolver.New(servers)
+	writes, err := newWriteJournal(store.Named("journal"))
+	if err != nil {
+		_logger.Error().Err(err).Msg("Error loading the write journal, starting an empty one")
+	}
 	syncs := make(map[string]*Sync)
 	for _, s := range cfg.Sync {
-		skipTrakt := true
-		source, ok := servers[s.Source]
-		if !ok {
+		if _, ok := cfg.Servers[s.Source]; !ok {
 			_logger.Info().Msgf("Source server %s not found, skipping sync", s.Source)
 			continue
 		}
-		targets := make([]media_servers.Server, 0)
+		targets := make([]string, 0)
 		for _, t := range s.Targets {
 			if t == s.Source {
 				_logger.Info().Msgf("Skipping sync to self (%s) for %s", s.Source, s.Name)
 				continue
 			}
-			if t == "trakt" {
-				skipTrakt = false
-				if traktClient == nil {
-					_logger.Info().Msgf("Trakt client is not initialized, skipping sync for %s", s.Name)
-					skipTrakt = true
-					continue
-				}
-				continue
-			}
-
-			target, ok := servers[t]
-			if !ok {
+			if _, ok := cfg.Servers[t]; !ok {
 				_logger.Info().Msgf("Target server %s not found, skipping sync for %s", t, s.Name)
 				continue
 			}
-			targets = append(targets, target)
+			targets = append(targets, t)
 		}
 		_interval := cfg.Interval
 		if s.Interval != nil {
@@ -74,21 +106,47 @@ func New(servers map[string]media_servers.Server) (*Scrobble, error) {
 		}
 
 		syn := &Sync{
-			source:   source,
-			sessions: types.NewMediaSessionHistory(),
-			targets:  targets,
-			interval: interval,
-			logger:   _logger.With().Str("Sync", s.Name).Str("Source", source.GetName()).Logger(),
-		}
-		if !skipTrakt {
-			syn.trakt = traktClient
-			syn.logger.Info().Msg("Trakt sync enabled")
-		} else {
-			syn.logger.Info().Msg("Trakt sync disabled")
+			name:       s.Name,
+			servers:    servers,
+			resolver:   ids,
+			source:     s.Source,
+			sessions:   types.NewMediaSessionHistory(),
+			targets:    targets,
+			interval:   interval,
+			history:    s.History,
+			ratings:    s.Ratings,
+			watchlist:  s.Watchlist,
+			collection: s.Collection,
+			unwatched:  s.Unwatched,
+			playCounts: s.PlayCounts,
+			dryRun:     cfg.IsDryRun(s),
+			journal:    writes,
+			logger:     _logger.With().Str("Sync", s.Name).Str("Source", s.Source).Logger(),
+		}
+		if s.Resume {
+			syn.resume = s.GetResumeMinOffset()
+			if syn.resume == 0 {
+				syn.resume = time.Millisecond // Any position past the start
+			}
 		}
 		syncs[s.Name] = syn
 	}
 
+	// Syncs sharing a source see the same sessions, so only the first one publishes them. Dry runs
+	// send nothing, sinks included.
+	names := make([]string, 0, len(syncs))
+	for name := range syncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	publishing := make(map[string]bool)
+	for _, name := range names {
+		if syn := syncs[name]; !syn.dryRun && !publishing[syn.source] {
+			publishing[syn.source] = true
+			syn.sinks = sinks
+		}
+	}
+
 	s := &Scrobble{
 		syncs:  syncs,
 		logger: _logger,
@@ -98,74 +156,520 @@ func New(servers map[string]media_servers.Server) (*Scrobble, error) {
 
 func (s *Sync) scrobble(ctx context.Context) error {
 	s.logger.Info().Msg("starting scrobble")
+	if s.dryRun {
+		s.logger.Info().Msg("Dry run, writes to the targets are recorded in the ledger instead of sent")
+	}
 
 	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
+	waiting := false
 	for {
 		select {
 		case <-ctx.Done():
 			s.logger.Info().Msg("context cancelled, stopping scrobble")
 			return nil
 		case <-ticker.C:
-			activeSessions, err := s.source.GetSessions() // Get Active Sessions
+			// The source may still be unreachable, the sync starts once it connects
+			server, ok := s.servers.Get(s.source)
+			if !ok {
+				if !waiting {
+					s.logger.Info().Msgf("Waiting for %s to connect", s.source)
+					waiting = true
+				}
+				continue
+			}
+			if waiting {
+				s.logger.Info().Msgf("%s connected, resuming sync", s.source)
+				waiting = false
+			}
+			source, ok := server.(media_servers.SessionSource)
+			if !ok {
+				s.logger.Error().Msgf("Source server %s does not report sessions, stopping sync", s.source)
+				return nil
+			}
+			activeSessions, err := source.GetSessions() // Get Active Sessions
 			if err != nil {
 				s.logger.Error().Err(err).Msgf("Error getting sessions")
+				s.servers.MarkDegraded(s.source, err)
 				continue
 			}
+			s.servers.MarkHealthy(s.source)
 			totalActiveSessions := len(activeSessions)
 			if totalActiveSessions > 0 {
 				s.logger.Debug().Msgf("Found %d active sessions", totalActiveSessions)
 			}
 			s.sync(activeSessions)
+
+			if s.history && time.Since(s.lastHistorySync) >= historyInterval {
+				s.syncHistory(server)
+				s.lastHistorySync = time.Now()
+			}
+			if s.ratings != "" && time.Since(s.lastRatingsSync) >= ratingsInterval {
+				s.syncRatings()
+				s.lastRatingsSync = time.Now()
+			}
+			if s.watchlist != nil && time.Since(s.lastWatchlistSync) >= watchlistInterval {
+				s.syncWatchlist(server)
+				s.lastWatchlistSync = time.Now()
+			}
+			if s.collection && time.Since(s.lastCollectionSync) >= collectionInterval {
+				s.syncCollection(server)
+				s.lastCollectionSync = time.Now()
+			}
+			if s.unwatched && time.Since(s.lastUnwatchedSync) >= unwatchedInterval {
+				s.syncUnwatched(server)
+				s.lastUnwatchedSync = time.Now()
+			}
+			if s.playCounts && time.Since(s.lastPlayCountSync) >= playCountsInterval {
+				s.syncPlayCounts(server)
+				s.lastPlayCountSync = time.Now()
+			}
 		}
 	}
 }
 
+// historyState is how far a history sync has copied the plays of its source
+type historyState struct {
+	Since time.Time                   `json:"since"` // Every play before it was copied to every target
+	Done  map[string]map[string]int64 `json:"done"`  // The plays since then each target took or rejected for good, by historyKey
+}
+
+// loadHistoryState reads the state of a history sync, including the time of the last copied play
+// saved by earlier versions
+func loadHistoryState(key string) (historyState, bool, error) {
+	state := historyState{Done: make(map[string]map[string]int64)}
+	var raw json.RawMessage
+	found, err := store.Get().Load(key, &raw)
+	if err != nil || !found {
+		return state, found, err
+	}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		var last time.Time
+		if err := json.Unmarshal(raw, &last); err != nil {
+			return state, true, fmt.Errorf("error decoding history sync state: %w", err)
+		}
+		state.Since = last.Add(time.Second)
+	}
+	if state.Done == nil {
+		state.Done = make(map[string]map[string]int64)
+	}
+	return state, true, nil
+}
+
+// advance moves the state past the plays every target is done with, keeping the plays of the
+// targets at or after the new point to skip them next time
+func (h *historyState) advance(plays []types.MediaSession, targets []string) {
+	since := h.Since
+	for _, item := range plays {
+		since = time.Unix(item.ViewedAt, 0)
+		pending := false
+		for _, target := range targets {
+			if _, ok := h.Done[target][historyKey(item)]; !ok {
+				pending = true
+			}
+		}
+		if pending {
+			break
+		}
+	}
+	h.Since = since
+	for target, done := range h.Done {
+		for key, viewedAt := range done {
+			if viewedAt < since.Unix() {
+				delete(done, key)
+			}
+		}
+		if len(done) == 0 {
+			delete(h.Done, target)
+		}
+	}
+}
+
+// markDone records that a target took or rejected for good a play
+func (h *historyState) markDone(target string, item types.MediaSession) {
+	if h.Done[target] == nil {
+		h.Done[target] = make(map[string]int64)
+	}
+	h.Done[target][historyKey(item)] = item.ViewedAt
+}
+
+// isDone reports whether a write to a target does not have to be tried again
+func isDone(err error) bool {
+	return err == nil || errors.Is(err, errNotFound) || errors.Is(err, media_servers.ErrUnsupported)
+}
+
+// syncHistory copies the plays recorded on the source since the last run to the targets
+func (s *Sync) syncHistory(server media_servers.Server) {
+	key := s.stateKey("history:" + s.name)
+	state, found, err := loadHistoryState(key)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error loading history sync state")
+		return
+	}
+	if !found {
+		// Copying the whole history of a source could take hours, only new plays are synced
+		s.logger.Info().Msg("Starting history sync, plays from now on will be copied")
+		state.Since = time.Now()
+		if err := store.Get().Save(key, state); err != nil {
+			s.logger.Error().Err(err).Msg("Error saving history sync state")
+		}
+		return
+	}
+
+	var history []types.MediaSession
+	if source, ok := server.(media_servers.IncrementalHistory); ok {
+		history, err = source.GetWatchHistorySince(state.Since)
+	} else if source, ok := server.(media_servers.HistorySource); ok {
+		history, err = source.GetWatchHistory()
+	} else {
+		s.logger.Error().Msgf("Source server %s cannot read history, disabling history sync", s.source)
+		s.history = false
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error getting watch history")
+		return
+	}
+
+	plays := make([]types.MediaSession, 0, len(history))
+	for _, item := range history {
+		// Plays in the second of the last copied one may have come in since, those already copied are skipped below
+		if item.ViewedAt >= state.Since.Unix() {
+			item.Source = s.source
+			// A file spanning several episodes is a play of each
+			plays = append(plays, types.SplitEpisodes(s.tagOrigin(s.resolver.Resolve(item)))...)
+		}
+	}
+	if len(plays) == 0 {
+		return
+	}
+	targets := s.getHistoryWriters()
+	if len(targets) < len(s.targets) {
+		// Try again later rather than moving on without the missing targets
+		s.logger.Debug().Msg("Some targets are not connected, postponing history sync")
+		return
+	}
+	sort.Slice(plays, func(i, j int) bool {
+		return plays[i].ViewedAt < plays[j].ViewedAt
+	})
+
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		name := target.GetName()
+		names = append(names, name)
+		targetPlays := make([]types.MediaSession, 0, len(plays))
+		for _, item := range plays {
+			if _, ok := state.Done[name][historyKey(item)]; ok {
+				continue
+			}
+			if item.Origin == name {
+				// Plays that first came from the target are not written back to it
+				s.logger.Trace().Msgf("[%s] Skipping %s, it came from there", name, item.Title)
+				s.filter(item, name, "scrobble", "came from the target")
+				state.markDone(name, item)
+				continue
+			}
+			targetPlays = append(targetPlays, item)
+		}
+		if len(targetPlays) == 0 {
+			continue
+		}
+		s.logger.Info().Msgf("[%s] Copying %d new plays from %s", name, len(targetPlays), s.source)
+		if s.dryRun {
+			for _, item := range s.renumber(targetPlays, name) {
+				s.preview(target, item, "scrobble")
+			}
+			for _, item := range targetPlays {
+				state.markDone(name, item)
+			}
+			continue
+		}
+		if batch, ok := target.(media_servers.BatchHistoryWriter); ok {
+			for i, done := range s.syncHistoryBatch(batch, s.renumber(targetPlays, name)) {
+				if done {
+					state.markDone(name, targetPlays[i])
+				}
+			}
+			continue
+		}
+		for _, item := range targetPlays {
+			renumbered := s.resolver.Renumber(item, s.source, name)
+			err := target.SyncHistory(renumbered)
+			if err != nil {
+				s.logger.Error().Err(err).Msgf("Error syncing history to %s", name)
+			} else {
+				s.logger.Trace().Msgf("[%s] Synced %s", name, item.Title)
+			}
+			s.record(renumbered, name, "scrobble", err)
+			if isDone(err) {
+				state.markDone(name, item)
+			}
+		}
+	}
+
+	// Plays a target failed to take hold the state back, so they are tried again next time
+	state.advance(plays, names)
+	if err := store.Get().Save(key, state); err != nil {
+		s.logger.Error().Err(err).Msg("Error saving history sync state")
+	}
+}
+
+// syncHistoryBatch sends all plays to a target in as few requests as it allows, recording each
+// play the target could not match. It returns which plays the target took or rejected for good.
+func (s *Sync) syncHistoryBatch(target media_servers.BatchHistoryWriter, plays []types.MediaSession) []bool {
+	sent, notFound, err := target.SyncHistoryBatch(plays)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("Error syncing history to %s after %d of %d plays", target.GetName(), sent, len(plays))
+	}
+	missing := make(map[string]bool, len(notFound))
+	for _, item := range notFound {
+		missing[historyKey(item)] = true
+	}
+	done := make([]bool, len(plays))
+	for i, item := range plays {
+		var itemErr error
+		switch {
+		case i >= sent:
+			itemErr = err
+		case missing[historyKey(item)]:
+			itemErr = fmt.Errorf("%w on %s", errNotFound, target.GetName())
+			s.logger.Warn().Msgf("[%s] Could not match %s", target.GetName(), item.Title)
+		}
+		s.record(item, target.GetName(), "scrobble", itemErr)
+		done[i] = isDone(itemErr)
+	}
+	return done
+}
+
+// renumber converts the episode numbers of plays to the episode orders of a target
+func (s *Sync) renumber(plays []types.MediaSession, target string) []types.MediaSession {
+	renumbered := make([]types.MediaSession, len(plays))
+	for i, item := range plays {
+		renumbered[i] = s.resolver.Renumber(item, s.source, target)
+	}
+	return renumbered
+}
+
+// tagOrigin sets where a change read from the source first came from, when another sync wrote it there
+func (s *Sync) tagOrigin(session types.MediaSession) types.MediaSession {
+	if origin := s.journal.origin(s.source, session); origin != "" {
+		session.Origin = origin
+	}
+	return session
+}
+
+// historyKey identifies a single play
+func historyKey(session types.MediaSession) string {
+	return fmt.Sprintf("%s@%d", types.GetMediaKey(session), session.ViewedAt)
+}
+
+// getTargets returns the targets that are connected and accept scrobbles
+func (s *Sync) getTargets() []media_servers.LiveScrobbler {
+	targets := make([]media_servers.LiveScrobbler, 0, len(s.targets))
+	for _, name := range s.targets {
+		server, ok := s.servers.Get(name)
+		if !ok {
+			s.logger.Debug().Msgf("Target %s is not connected, skipping it", name)
+			continue
+		}
+		target, ok := server.(media_servers.LiveScrobbler)
+		if !ok {
+			s.logger.Error().Msgf("Target server %s does not accept scrobbles, skipping it", name)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// getHistoryWriters returns the targets that are connected and record completed plays
+func (s *Sync) getHistoryWriters() []media_servers.HistoryWriter {
+	targets := make([]media_servers.HistoryWriter, 0, len(s.targets))
+	for _, name := range s.targets {
+		server, ok := s.servers.Get(name)
+		if !ok {
+			s.logger.Debug().Msgf("Target %s is not connected, skipping it", name)
+			continue
+		}
+		target, ok := server.(media_servers.HistoryWriter)
+		if !ok {
+			s.logger.Error().Msgf("Target server %s does not record history, skipping it", name)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
 func (s *Sync) sync(activeSessions []types.MediaSession) {
+	active := make(map[string]bool, len(activeSessions))
+	previous := make(map[string]types.MediaSession)
+	for _, session := range activeSessions {
+		key := types.GetHistoryKey(session)
+		active[key] = true
+		if prev, ok := s.sessions.Get(key); ok {
+			previous[key] = prev
+		}
+	}
+
 	// Set active sessions in the history
 	s.sessions.SetMany(activeSessions)
+	targets := s.getTargets()
 
-	sessions := s.sessions.GetAll()
-
-	// If active sessions are empty, mark all existing sessions as stopped
-	if len(activeSessions) == 0 {
-		for _, session := range sessions {
+	for _, session := range s.sessions.GetAll() {
+		key := types.GetHistoryKey(session)
+		// Sessions no longer reported by the source have stopped
+		if !active[key] {
 			session.State = "stopped"
-			s.sessions.Set(session)
 		}
-	}
+		session.Source = s.source
+
+		action := getAction(session)
+		if action == "stop" && session.Progress > 90 {
+			session.Progress = 100 // Set progress to 100% for completed items
+			if session.ViewedAt == 0 {
+				session.ViewedAt = time.Now().Unix()
+			}
+		}
+
+		// Targets match on external IDs, so fill in those the source does not report
+		session = s.tagOrigin(s.resolver.Resolve(session))
 
-	for _, session := range sessions {
-		if s.trakt != nil {
-			s.syncToTrakt(session)
+		// The retained state follows the progress of playing sessions, and ends with the stop
+		if prev, ok := previous[key]; !ok || prev.State != session.State || prev.ViewOffset != session.ViewOffset {
+			s.publish(session, action)
 		}
 
-		for _, target := range s.targets {
-			action := getAction(session)
-			if action == "stop" && session.Progress > 90 {
-				session.Progress = 100 // Set progress to 100% for completed items
+		episodes := types.SplitEpisodes(session)
+		for _, target := range targets {
+			if session.Origin == target.GetName() {
+				s.logger.Trace().Msgf("[%s] Skipping %s, it came from there", target.GetName(), session.Title)
+				if action == "stop" {
+					s.filter(episodes[0], target.GetName(), action, "came from the target")
+				}
+				continue
+			}
+			if writer, ok := target.(media_servers.ResumeWriter); ok && s.resume > 0 {
+				// No playback session is opened on the target, only where playback ended is copied
+				switch {
+				case session.State == "stopped" && action == "pause":
+					s.setResume(writer, episodes[0])
+				case action == "stop":
+					for _, episode := range episodes {
+						s.markWatched(target, episode)
+					}
+				}
+				continue
 			}
-			if err := target.Scrobble(session, action); err != nil {
-				s.logger.Error().Err(err).Msgf("Error scrobbling from %s", target.GetName())
+			item := s.resolver.Renumber(episodes[0], s.source, target.GetName())
+			if s.dryRun {
+				s.preview(target, item, action)
 			} else {
-				s.logger.Trace().Msgf("[%s] Scrobbled %s: %s at %.2f%%", target.GetName(), action, session.Title, session.Progress)
+				err := target.Scrobble(item, action)
+				if err != nil {
+					s.logger.Error().Err(err).Msgf("Error scrobbling from %s", target.GetName())
+				} else {
+					s.logger.Trace().Msgf("[%s] Scrobbled %s: %s at %.2f%%", target.GetName(), action, session.Title, session.Progress)
+				}
+				s.record(session, target.GetName(), action, err)
+			}
+			if action == "stop" {
+				// Targets only saw the first episode of a multi-episode file played
+				for _, episode := range episodes[1:] {
+					s.markWatched(target, episode)
+				}
 			}
 		}
+
+		// A stopped session has been scrobbled for the last time
+		if session.State == "stopped" {
+			s.sessions.Delete(key)
+		}
 	}
 
 }
 
-func (s *Sync) syncToTrakt(session types.MediaSession) {
-	action := getAction(session)
-	if action == "stop" && session.Progress > 90 {
-		session.Progress = 100 // Set progress to 100% for completed items
+// setResume copies where playback of an unfinished item stopped to a target, unless it stopped near the start
+func (s *Sync) setResume(target media_servers.ResumeWriter, session types.MediaSession) {
+	if time.Duration(session.ViewOffset)*time.Millisecond < s.resume {
+		s.logger.Trace().Msgf("[%s] Not copying resume position of %s, stopped near the start", target.GetName(), session.Title)
+		s.filter(session, target.GetName(), "resume", "stopped before the minimum resume position")
+		return
 	}
+	item := s.resolver.Renumber(session, s.source, target.GetName())
+	if s.dryRun {
+		s.preview(target, item, "resume")
+		return
+	}
+	err := target.SetResumePosition(item)
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("Error setting resume position on %s", target.GetName())
+	} else {
+		s.logger.Trace().Msgf("[%s] Resume %s at %s", target.GetName(), session.Title, time.Duration(session.ViewOffset)*time.Millisecond)
+	}
+	s.record(session, target.GetName(), "resume", err)
+}
 
-	if err := s.trakt.Scrobble(session, action); err != nil {
-		s.logger.Error().Err(err).Msgf("Error syncing to Trakt")
+// markWatched marks an episode of a multi-episode file as watched on a target, as a play when
+// the target takes history and as a finished scrobble otherwise
+func (s *Sync) markWatched(target media_servers.LiveScrobbler, episode types.MediaSession) {
+	episode = s.resolver.Renumber(episode, s.source, target.GetName())
+	if s.dryRun {
+		s.preview(target, episode, "scrobble")
+		return
+	}
+	var err error
+	if writer, ok := target.(media_servers.HistoryWriter); ok {
+		err = writer.SyncHistory(episode)
 	} else {
-		s.logger.Trace().Msgf("Synced to Trakt: %s %s at %.2f%%", action, session.Title, session.Progress)
+		err = target.Scrobble(episode, "stop")
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("Error marking %s watched on %s", episode.Title, target.GetName())
+	} else {
+		s.logger.Trace().Msgf("[%s] Marked %s watched", target.GetName(), episode.Title)
+	}
+	s.record(episode, target.GetName(), "scrobble", err)
+}
+
+// publish sends a session state change to the sinks
+func (s *Sync) publish(session types.MediaSession, action string) {
+	for _, sink := range s.sinks {
+		if err := sink.Publish(s.source, session, action); err != nil {
+			s.logger.Error().Err(err).Msg("Error publishing session state")
+		}
+	}
+}
+
+// record adds completed scrobbles, history syncs and ratings to the ledger. Every successful write
+// goes to the write journal.
+func (s *Sync) record(session types.MediaSession, target, action string, err error) {
+	s.recordEntry(ledger.Entry{Target: target, Action: action, Session: session}, err)
+}
+
+// recordEntry records a write to entry.Target, filling in the sync and the outcome
+func (s *Sync) recordEntry(entry ledger.Entry, err error) {
+	if err == nil {
+		if err := s.journal.add(entry.Target, cmp.Or(entry.Session.Origin, s.source), entry.Session); err != nil {
+			s.logger.Error().Err(err).Msg("Error saving the write journal")
+		}
+	}
+	if entry.Action != "stop" && entry.Action != "scrobble" && entry.Action != "rate" {
+		return
+	}
+	entry.Sync = s.name
+	entry.Source = s.source
+	entry.Status = ledger.StatusSent
+	if err != nil {
+		entry.Status = ledger.StatusFailed
+		if errors.Is(err, errNotFound) {
+			entry.Status = ledger.StatusNotFound
+		}
+		entry.Error = err.Error()
+	}
+	if err := ledger.Get().Record(entry); err != nil {
+		s.logger.Error().Err(err).Msg("Error recording scrobble")
 	}
 }
 
@@ -0,0 +1,186 @@
+package scrobble
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"maps"
+	"time"
+)
+
+// unwatchedInterval is how often syncs propagating unwatched items compare the watched items of their source
+const unwatchedInterval = 15 * time.Minute
+
+// playedItem is what a sync remembers of a watched item of its source
+type playedItem struct {
+	Type       string    `json:"type"`
+	Title      string    `json:"title"`
+	Year       int       `json:"year,omitempty"`
+	IDs        types.IDs `json:"ids"`
+	ShowTitle  string    `json:"show_title,omitempty"`
+	ShowIDs    types.IDs `json:"show_ids,omitempty"`
+	SeasonNum  int       `json:"season_num,omitempty"`
+	EpisodeNum int       `json:"episode_num,omitempty"`
+}
+
+func newPlayedItem(session types.MediaSession) playedItem {
+	return playedItem{
+		Type:       session.Type,
+		Title:      session.Title,
+		Year:       session.Year,
+		IDs:        session.IDs,
+		ShowTitle:  session.ShowTitle,
+		ShowIDs:    session.ShowIDs,
+		SeasonNum:  session.SeasonNum,
+		EpisodeNum: session.EpisodeNum,
+	}
+}
+
+func (p playedItem) session() types.MediaSession {
+	session := types.MediaSession{
+		Type:       p.Type,
+		Title:      p.Title,
+		Year:       p.Year,
+		IDs:        p.IDs,
+		ShowTitle:  p.ShowTitle,
+		ShowIDs:    p.ShowIDs,
+		SeasonNum:  p.SeasonNum,
+		EpisodeNum: p.EpisodeNum,
+	}
+	if p.Type == "episode" {
+		session.EpisodeTitle = p.Title
+	}
+	return session
+}
+
+// playedKey identifies a watched item on its source, by the source's own ID when it has one
+func playedKey(session types.MediaSession) string {
+	switch {
+	case session.IDs.Plex != "":
+		return "plex:" + session.IDs.Plex
+	case session.IDs.Jellyfin != "":
+		return "jellyfin:" + session.IDs.Jellyfin
+	default:
+		return types.GetMediaKey(session)
+	}
+}
+
+// syncUnwatched marks items that were watched on the source and have been marked unwatched since
+// unwatched on the targets. Items that left the library are not unwatched.
+func (s *Sync) syncUnwatched(server media_servers.Server) {
+	source, ok := server.(media_servers.PlayedSource)
+	if !ok {
+		s.logger.Error().Msgf("Source server %s cannot list watched items, disabling unwatched sync", s.source)
+		s.unwatched = false
+		return
+	}
+	played, err := source.GetPlayed()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error getting watched items")
+		return
+	}
+	current := make(map[string]playedItem, len(played))
+	for _, item := range played {
+		current[playedKey(item)] = newPlayedItem(item)
+	}
+
+	key := s.stateKey("played:" + s.name)
+	var previous map[string]playedItem
+	found, err := playedStore().Load(key, &previous)
+	legacy := false
+	if err == nil && !found {
+		// Older versions kept it in state.json
+		found, err = store.Get().Load(key, &previous)
+		legacy = found
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error loading unwatched sync state")
+		return
+	}
+	if !found {
+		s.logger.Info().Msg("Starting unwatched sync, items marked unwatched from now on will be copied")
+	} else {
+		targets := s.getUnwatchWriters()
+		if len(targets) < len(s.targets) {
+			// Try again later rather than missing the targets that are down
+			s.logger.Debug().Msg("Some targets are not connected, postponing unwatched sync")
+			return
+		}
+		for k, item := range previous {
+			if _, ok := current[k]; ok {
+				continue
+			}
+			session := item.session()
+			stillPlayed, exists, err := source.IsPlayed(session)
+			switch {
+			case err != nil:
+				s.logger.Debug().Err(err).Msgf("Error checking whether %s is still watched", item.Title)
+				current[k] = item // Check again next time
+			case !exists:
+				s.logger.Trace().Msgf("%s left the library, not marking it unwatched", item.Title)
+			case stillPlayed:
+				current[k] = item
+			default:
+				s.unwatch(targets, session)
+			}
+		}
+	}
+	if found && !legacy && maps.Equal(previous, current) {
+		return
+	}
+	if err := playedStore().Save(key, current); err != nil {
+		s.logger.Error().Err(err).Msg("Error saving unwatched sync state")
+		return
+	}
+	if legacy {
+		if err := store.Get().Delete(key); err != nil {
+			s.logger.Error().Err(err).Msg("Error removing the old unwatched sync state")
+		}
+	}
+}
+
+// playedStore keeps the watched items of the sources, a list as long as their history, out of state.json
+func playedStore() *store.Store {
+	return store.Named("played")
+}
+
+// unwatch marks an item unwatched on every target
+func (s *Sync) unwatch(targets []media_servers.UnwatchWriter, session types.MediaSession) {
+	session.Source = s.source
+	session = s.tagOrigin(s.resolver.Resolve(session))
+	s.logger.Info().Msgf("%s was marked unwatched on %s", session.Title, s.source)
+	for _, target := range targets {
+		if session.Origin == target.GetName() {
+			continue
+		}
+		if s.dryRun {
+			s.preview(target, s.resolver.Renumber(session, s.source, target.GetName()), "unwatch")
+			continue
+		}
+		err := target.MarkUnwatched(s.resolver.Renumber(session, s.source, target.GetName()))
+		if err != nil {
+			s.logger.Error().Err(err).Msgf("Error marking %s unwatched on %s", session.Title, target.GetName())
+		} else {
+			s.logger.Trace().Msgf("[%s] Marked %s unwatched", target.GetName(), session.Title)
+		}
+		s.record(session, target.GetName(), "unwatch", err)
+	}
+}
+
+func (s *Sync) getUnwatchWriters() []media_servers.UnwatchWriter {
+	targets := make([]media_servers.UnwatchWriter, 0, len(s.targets))
+	for _, name := range s.targets {
+		server, ok := s.servers.Get(name)
+		if !ok {
+			s.logger.Debug().Msgf("Target %s is not connected, skipping it", name)
+			continue
+		}
+		target, ok := server.(media_servers.UnwatchWriter)
+		if !ok {
+			s.logger.Error().Msgf("Target server %s cannot mark items unwatched, skipping it", name)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
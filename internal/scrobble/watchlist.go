@@ -0,0 +1,174 @@
+package scrobble
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/store"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"sort"
+	"time"
+)
+
+// watchlistInterval is how often syncs mirroring a watchlist update the targets' lists
+const watchlistInterval = 30 * time.Minute
+
+// watchlistMissRetry is how long a watchlist item missing from a target's library is not looked up again
+const watchlistMissRetry = 24 * time.Hour
+
+// watchlistState is what a sync knows about a target's list, by media key
+type watchlistState struct {
+	Added   []string         `json:"added"`             // Items the sync added, removed once watched or off the watchlist
+	Ignored []string         `json:"ignored"`           // Items already in the list before the first sync or added by hand, left alone
+	Missing map[string]int64 `json:"missing,omitempty"` // Watchlist items the target's library lacked, with when they were looked up
+}
+
+// syncWatchlist mirrors the unwatched items of the source's watchlist to a list on each target.
+// With reverse, items added to a target's list by hand are added to the watchlist.
+func (s *Sync) syncWatchlist(server media_servers.Server) {
+	source, ok := server.(media_servers.WatchlistSource)
+	if !ok {
+		s.logger.Error().Msgf("Source server %s has no watchlist, disabling watchlist sync", s.source)
+		s.watchlist = nil
+		return
+	}
+	watchlist, err := source.GetWatchlist()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error getting watchlist")
+		return
+	}
+
+	reverse := make([]types.MediaSession, 0)
+	for _, name := range s.targets {
+		server, ok := s.servers.Get(name)
+		if !ok {
+			s.logger.Debug().Msgf("Target %s is not connected, skipping it", name)
+			continue
+		}
+		target, ok := server.(media_servers.ListMirror)
+		if !ok {
+			s.logger.Error().Msgf("Target server %s cannot mirror a watchlist, skipping it", name)
+			continue
+		}
+		added, err := s.mirrorWatchlist(target, watchlist)
+		if err != nil {
+			s.logger.Error().Err(err).Msgf("Error mirroring watchlist to %s", name)
+			continue
+		}
+		reverse = append(reverse, added...)
+	}
+
+	if len(reverse) > 0 && s.dryRun {
+		for _, item := range reverse {
+			s.preview(source, item, "watchlist_add")
+		}
+	} else if len(reverse) > 0 {
+		if err := source.AddToWatchlist(reverse); err != nil {
+			s.logger.Error().Err(err).Msg("Error adding items to the watchlist")
+			return
+		}
+		s.logger.Info().Msgf("Added %d items to the %s watchlist", len(reverse), s.source)
+	}
+}
+
+// mirrorWatchlist updates the list of one target and returns the items added to it by hand
+func (s *Sync) mirrorWatchlist(target media_servers.ListMirror, watchlist []types.MediaSession) ([]types.MediaSession, error) {
+	name := s.watchlist.GetName()
+	list, err := target.GetList(name)
+	if err != nil {
+		return nil, err
+	}
+	key := s.stateKey("watchlist:" + s.name + ":" + target.GetName())
+	var state watchlistState
+	found, err := store.Get().Load(key, &state)
+	if err != nil {
+		return nil, err
+	}
+	added := toSet(state.Added)
+	ignored := toSet(state.Ignored)
+
+	wanted := newMediaIndex(watchlist)
+	reverse := make([]types.MediaSession, 0)
+	for _, item := range list {
+		itemKey := types.GetMediaKey(item)
+		_, onWatchlist := wanted.find(item)
+		switch {
+		case added[itemKey]:
+			// Watched or removed from the watchlist
+			if (item.Progress >= 100 || !onWatchlist) && s.removeFromList(target, name, item) {
+				delete(added, itemKey)
+			}
+		case !found:
+			ignored[itemKey] = true
+		case ignored[itemKey]:
+		case onWatchlist:
+			// Added by hand and on the watchlist, possibly through reverse, so it is not added again
+			ignored[itemKey] = true
+		case s.watchlist.Reverse && item.Progress < 100:
+			reverse = append(reverse, item)
+		}
+	}
+
+	listed := newMediaIndex(list)
+	now := time.Now()
+	missing := make(map[string]int64)
+	for _, item := range watchlist {
+		if _, ok := listed.find(item); ok {
+			continue
+		}
+		itemKey := types.GetMediaKey(item)
+		if missedAt, ok := state.Missing[itemKey]; ok && now.Sub(time.Unix(missedAt, 0)) < watchlistMissRetry {
+			// Not in the library when last looked up
+			missing[itemKey] = missedAt
+			continue
+		}
+		if s.dryRun {
+			s.preview(target, item, "list_add")
+			continue
+		}
+		libraryItem, ok, err := target.AddToList(name, item)
+		if err != nil {
+			s.logger.Error().Err(err).Msgf("Error adding %s to %s", item.Title, target.GetName())
+			continue
+		}
+		if ok {
+			added[types.GetMediaKey(libraryItem)] = true
+		} else {
+			missing[itemKey] = now.Unix()
+		}
+	}
+
+	state = watchlistState{Added: fromSet(added), Ignored: fromSet(ignored), Missing: missing}
+	if err := store.Get().Save(key, state); err != nil {
+		s.logger.Error().Err(err).Msg("Error saving watchlist sync state")
+	}
+	return reverse, nil
+}
+
+// removeFromList removes an item from a target's list, reporting whether it succeeded
+func (s *Sync) removeFromList(target media_servers.ListMirror, name string, item types.MediaSession) bool {
+	if s.dryRun {
+		s.preview(target, item, "list_remove")
+		return true
+	}
+	if err := target.RemoveFromList(name, item); err != nil {
+		s.logger.Error().Err(err).Msgf("Error removing %s from %s", item.Title, target.GetName())
+		return false
+	}
+	return true
+}
+
+func toSet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+func fromSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	instance *Store
+	once     sync.Once
+	named    = make(map[string]*Store)
+	namedMu  sync.Mutex
+)
+
+// Store keeps small pieces of state between restarts, such as how far a history sync got.
+// Values are stored as JSON under a key in a single file.
+type Store struct {
+	path string
+	data map[string]json.RawMessage
+	mu   sync.Mutex
+}
+
+func New(path string) *Store {
+	return &Store{path: path}
+}
+
+// Get returns the store kept in the config folder
+func Get() *Store {
+	once.Do(func() {
+		instance = New(filepath.Join(config.Get().Path, "state.json"))
+	})
+	return instance
+}
+
+// Named returns a store kept in its own file of the config folder, for state too large to rewrite
+// with every change to state.json
+func Named(name string) *Store {
+	namedMu.Lock()
+	defer namedMu.Unlock()
+	s, ok := named[name]
+	if !ok {
+		s = New(filepath.Join(config.Get().Path, name+".json"))
+		named[name] = s
+	}
+	return s
+}
+
+// load reads the file on first use. The caller must hold s.mu.
+func (s *Store) load() error {
+	if s.data != nil {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.data = make(map[string]json.RawMessage)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading state file: %w", err)
+	}
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("error parsing state file: %w", err)
+	}
+	s.data = values
+	return nil
+}
+
+// Load decodes the value stored under key into v, reporting whether it was found
+func (s *Store) Load(key string, v any) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	value, ok := s.data[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		return false, fmt.Errorf("error decoding state %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Save stores a value under key and writes the file
+func (s *Store) Save(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding state %s: %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.data[key] = value
+	return s.write()
+}
+
+// Delete removes the value stored under key
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+	delete(s.data, key)
+	return s.write()
+}
+
+// Prune removes the values for which keep returns false, and reports how many it removed
+func (s *Store) Prune(keep func(key string, value json.RawMessage) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+	var removed int
+	for key, value := range s.data {
+		if !keep(key, value) {
+			delete(s.data, key)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.write()
+}
+
+// write replaces the file atomically, so a crash never leaves it half written. The caller must hold s.mu.
+func (s *Store) write() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state file: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	return nil
+}
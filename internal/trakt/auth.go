@@ -0,0 +1,197 @@
+package trakt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrLoginExpired is shown when Trakt rejects the refresh token
+const ErrLoginExpired = "Trakt login expired or was revoked"
+
+// refreshLock serializes refreshes, all Trakt clients share the same tokens
+var refreshLock sync.Mutex
+
+// tokenResponse is the response of /oauth/token
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// SaveLogin stores the tokens of a new login, shared by every Trakt client, and clears an expired login
+func SaveLogin(accessToken, refreshToken, tokenType string, expiresIn int, createdAt int64) error {
+	refreshLock.Lock()
+	defer refreshLock.Unlock()
+	cfg := config.Get()
+	if cfg.Trakt == nil {
+		cfg.Trakt = &config.Trakt{}
+	}
+	if createdAt == 0 {
+		createdAt = time.Now().Unix()
+	}
+	cfg.Trakt.AccessToken = accessToken
+	cfg.Trakt.RefreshToken = refreshToken
+	cfg.Trakt.ExpiresIn = expiresIn
+	cfg.Trakt.CreatedAt = createdAt
+	cfg.Trakt.TokenType = tokenType
+	cfg.Trakt.AuthError = ""
+	cfg.TraktEnabled = true
+	return cfg.SaveTrakt()
+}
+
+// LoginError returns why the user has to authenticate again, or "" if the login is valid
+func LoginError() string {
+	refreshLock.Lock()
+	defer refreshLock.Unlock()
+	if trakt := config.Get().Trakt; trakt != nil {
+		return trakt.AuthError
+	}
+	return ""
+}
+
+// loadLogin returns the shared login of the Trakt clients, or nil before the first login
+func loadLogin() *config.Trakt {
+	refreshLock.Lock()
+	defer refreshLock.Unlock()
+	return config.Get().Trakt
+}
+
+// accessToken returns the current access token
+func (t *Client) accessToken() string {
+	refreshLock.Lock()
+	defer refreshLock.Unlock()
+	return t.config.AccessToken
+}
+
+// do sends a request with the current access token. The token is refreshed first when
+// it is about to expire, and once more if Trakt rejects it, retrying the request.
+func (t *Client) do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+		req.Body.Close()
+	}
+
+	refreshLock.Lock()
+	needsRefresh := t.config.NeedsRefresh()
+	authError := t.config.AuthError
+	refreshLock.Unlock()
+	if authError != "" {
+		// Trakt would reject the tokens until the user authenticates again
+		return nil, fmt.Errorf("%s, authenticate Trakt again", authError)
+	}
+	if needsRefresh {
+		if err := t.refresh(t.accessToken()); err != nil {
+			t.logger.Warn().Err(err).Msg("Failed to refresh Trakt token before it expires")
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		token := t.accessToken()
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		t.logger.Info().Msg("Trakt rejected the access token, refreshing it")
+		if err := t.refresh(token); err != nil {
+			return nil, fmt.Errorf("trakt access token rejected: %w", err)
+		}
+	}
+}
+
+// refresh exchanges the refresh token for new tokens and saves them.
+// It does nothing if another client already replaced the stale token.
+func (t *Client) refresh(stale string) error {
+	refreshLock.Lock()
+	defer refreshLock.Unlock()
+	if t.config.AccessToken != stale {
+		return nil
+	}
+	if t.config.AuthError != "" {
+		// The refresh token was already rejected, only a new login helps
+		return errors.New(t.config.AuthError)
+	}
+	if t.config.RefreshToken == "" {
+		return t.loginExpired(fmt.Errorf("no refresh token"))
+	}
+
+	cfg := config.Get()
+	payload, err := json.Marshal(map[string]string{
+		"refresh_token": t.config.RefreshToken,
+		"client_id":     cfg.GetTraktClientID(),
+		"client_secret": cfg.GetTraktClientSecret(),
+		"redirect_uri":  "urn:ietf:wg:oauth:2.0:oob",
+		"grant_type":    "refresh_token",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth/token", t.APIBaseURL), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		// The refresh token is invalid, expired or revoked
+		body, _ := io.ReadAll(resp.Body)
+		return t.loginExpired(fmt.Errorf("trakt API error %d: %s", resp.StatusCode, string(body)))
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("trakt API error: %d", resp.StatusCode)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if token.CreatedAt == 0 {
+		token.CreatedAt = time.Now().Unix()
+	}
+	t.config.AccessToken = token.AccessToken
+	t.config.RefreshToken = token.RefreshToken
+	t.config.ExpiresIn = token.ExpiresIn
+	t.config.CreatedAt = token.CreatedAt
+	t.config.TokenType = token.TokenType
+	t.config.AuthError = ""
+	if err := cfg.SaveTrakt(); err != nil {
+		return err
+	}
+	t.logger.Info().Msgf("Refreshed Trakt token, valid until %s", t.config.ExpiresAt().Format(time.DateOnly))
+	return nil
+}
+
+// loginExpired records that the user needs to authenticate again. The caller must hold refreshLock.
+func (t *Client) loginExpired(err error) error {
+	t.config.AuthError = ErrLoginExpired
+	if err := config.Get().SaveTrakt(); err != nil {
+		t.logger.Error().Err(err).Msg("Failed to save Trakt login state")
+	}
+	return fmt.Errorf("%s: %w", ErrLoginExpired, err)
+}
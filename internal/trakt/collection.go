@@ -0,0 +1,148 @@
+package trakt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// collectionBatchSize is the number of items sent per /sync/collection request
+const collectionBatchSize = 100
+
+// AddToCollection adds movies and episodes to the user's collection, with their media info
+func (t *Client) AddToCollection(items []types.LibraryItem) error {
+	return t.sendCollection("/sync/collection", items, true)
+}
+
+// RemoveFromCollection removes movies and episodes from the user's collection
+func (t *Client) RemoveFromCollection(items []types.LibraryItem) error {
+	return t.sendCollection("/sync/collection/remove", items, false)
+}
+
+// sendCollection posts the items in batches
+func (t *Client) sendCollection(path string, items []types.LibraryItem, withMedia bool) error {
+	for start := 0; start < len(items); start += collectionBatchSize {
+		batch := items[start:min(start+collectionBatchSize, len(items))]
+		payload := collectionPayload(batch, withMedia)
+
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal collection: %w", err)
+		}
+		req, err := http.NewRequest("POST", t.APIBaseURL+path, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		resp, err := t.do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send request: %w", err)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return fmt.Errorf("trakt API error %d: %s", resp.StatusCode, string(body))
+		}
+		var result SyncResponse
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if notFound := result.NotFound.Count(); notFound > 0 {
+			t.logger.Debug().Msgf("Trakt did not find %d of %d collection items", notFound, len(batch))
+		}
+	}
+	return nil
+}
+
+// collectionPayload groups items the way /sync/collection expects them. Episodes without
+// their own IDs are sent under their show, which Trakt matches by its IDs or title.
+func collectionPayload(items []types.LibraryItem, withMedia bool) map[string]interface{} {
+	movies := make([]map[string]interface{}, 0)
+	episodes := make([]map[string]interface{}, 0)
+	shows := make([]map[string]interface{}, 0)
+	showKeys := make([]string, 0)
+	seasons := make(map[string]map[int][]map[string]interface{})
+
+	for _, item := range items {
+		session := item.Session
+		entry := map[string]interface{}{}
+		if withMedia {
+			addMediaInfo(entry, item)
+		}
+		switch {
+		case session.Type == "movie":
+			entry["title"] = session.Title
+			entry["year"] = session.Year
+			entry["ids"] = traktIDs(session.IDs)
+			movies = append(movies, entry)
+		case session.Type == "episode" && !traktIDs(session.IDs).isZero():
+			entry["ids"] = traktIDs(session.IDs)
+			episodes = append(episodes, entry)
+		case session.Type == "episode" && session.ShowTitle != "":
+			entry["number"] = session.EpisodeNum
+			// Shows sharing a title stay apart by their IDs, or the year when they have none
+			showKey := strings.Join(session.ShowIDs.External(), ",")
+			if showKey == "" {
+				showKey = fmt.Sprintf("%s (%d)", session.ShowTitle, session.Year)
+			}
+			if _, ok := seasons[showKey]; !ok {
+				seasons[showKey] = make(map[int][]map[string]interface{})
+				shows = append(shows, map[string]interface{}{
+					"title": session.ShowTitle,
+					"ids":   traktIDs(session.ShowIDs),
+				})
+				showKeys = append(showKeys, showKey)
+			}
+			seasons[showKey][session.SeasonNum] = append(seasons[showKey][session.SeasonNum], entry)
+		}
+	}
+
+	for i, show := range shows {
+		numbers := make([]int, 0, len(seasons[showKeys[i]]))
+		for number := range seasons[showKeys[i]] {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		showSeasons := make([]map[string]interface{}, 0, len(numbers))
+		for _, number := range numbers {
+			showSeasons = append(showSeasons, map[string]interface{}{
+				"number":   number,
+				"episodes": seasons[showKeys[i]][number],
+			})
+		}
+		show["seasons"] = showSeasons
+	}
+
+	return map[string]interface{}{
+		"movies":   movies,
+		"episodes": episodes,
+		"shows":    shows,
+	}
+}
+
+// addMediaInfo adds the collected time and what is known about the file
+func addMediaInfo(entry map[string]interface{}, item types.LibraryItem) {
+	if item.AddedAt > 0 {
+		entry["collected_at"] = time.Unix(item.AddedAt, 0).UTC().Format(time.RFC3339)
+	}
+	entry["media_type"] = "digital"
+	if item.Media.Resolution != "" {
+		entry["resolution"] = item.Media.Resolution
+	}
+	if item.Media.HDR != "" {
+		entry["hdr"] = item.Media.HDR
+	}
+	if item.Media.Audio != "" {
+		entry["audio"] = item.Media.Audio
+	}
+	if item.Media.AudioChannels != "" {
+		entry["audio_channels"] = item.Media.AudioChannels
+	}
+}
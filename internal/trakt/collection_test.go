@@ -0,0 +1,77 @@
+package trakt
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"testing"
+)
+
+func TestCollectionPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     []types.LibraryItem
+		withMedia bool
+		want      string
+	}{
+		{
+			name: "movie with media",
+			items: []types.LibraryItem{{
+				Session: types.MediaSession{Type: "movie", Title: "Alien", Year: 1979, IDs: types.IDs{TMDB: "348"}},
+				AddedAt: 1700000000,
+				Media:   types.MediaInfo{Resolution: "uhd_4k", HDR: "dolby_vision", Audio: "dolby_truehd", AudioChannels: "7.1"},
+			}},
+			withMedia: true,
+			want: `{"movies": [{"title": "Alien", "year": 1979, "ids": {"tmdb": 348}, "collected_at": "2023-11-14T22:13:20Z",
+				"media_type": "digital", "resolution": "uhd_4k", "hdr": "dolby_vision", "audio": "dolby_truehd", "audio_channels": "7.1"}],
+				"episodes": [], "shows": []}`,
+		},
+		{
+			name: "movie without media",
+			items: []types.LibraryItem{{
+				Session: types.MediaSession{Type: "movie", Title: "Alien", Year: 1979, IDs: types.IDs{TMDB: "348"}},
+				Media:   types.MediaInfo{Resolution: "uhd_4k"},
+			}},
+			want: `{"movies": [{"title": "Alien", "year": 1979, "ids": {"tmdb": 348}}], "episodes": [], "shows": []}`,
+		},
+		{
+			name: "episode with IDs",
+			items: []types.LibraryItem{{
+				Session: types.MediaSession{Type: "episode", ShowTitle: "Lost", SeasonNum: 1, EpisodeNum: 1, IDs: types.IDs{TVDB: "127131"}},
+			}},
+			want: `{"movies": [], "episodes": [{"ids": {"tvdb": 127131}}], "shows": []}`,
+		},
+		{
+			name: "episodes without IDs grouped by show and season",
+			items: []types.LibraryItem{
+				{Session: types.MediaSession{Type: "episode", ShowTitle: "Lost", SeasonNum: 2, EpisodeNum: 1, ShowIDs: types.IDs{TVDB: "73739"}}},
+				{Session: types.MediaSession{Type: "episode", ShowTitle: "Lost", SeasonNum: 1, EpisodeNum: 1, ShowIDs: types.IDs{TVDB: "73739"}}},
+			},
+			want: `{"movies": [], "episodes": [], "shows": [{"title": "Lost", "ids": {"tvdb": 73739}, "seasons": [
+				{"number": 1, "episodes": [{"number": 1}]},
+				{"number": 2, "episodes": [{"number": 1}]}
+			]}]}`,
+		},
+		{
+			name: "shows sharing a title without IDs",
+			items: []types.LibraryItem{
+				{Session: types.MediaSession{Type: "episode", ShowTitle: "Doctor Who", Year: 1963, SeasonNum: 1, EpisodeNum: 1}},
+				{Session: types.MediaSession{Type: "episode", ShowTitle: "Doctor Who", Year: 2005, SeasonNum: 1, EpisodeNum: 1}},
+			},
+			want: `{"movies": [], "episodes": [], "shows": [
+				{"title": "Doctor Who", "ids": {}, "seasons": [{"number": 1, "episodes": [{"number": 1}]}]},
+				{"title": "Doctor Who", "ids": {}, "seasons": [{"number": 1, "episodes": [{"number": 1}]}]}
+			]}`,
+		},
+		{
+			name: "episode without IDs or show",
+			items: []types.LibraryItem{
+				{Session: types.MediaSession{Type: "episode", SeasonNum: 1, EpisodeNum: 1}},
+			},
+			want: `{"movies": [], "episodes": [], "shows": []}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertPayload(t, collectionPayload(tt.items, tt.withMedia), tt.want)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package trakt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"net/url"
+)
+
+// GetEpisodes lists the episodes of a show with their aired and absolute numbers and air dates.
+// Trakt finds shows by Trakt ID, slug or IMDB ID.
+func (t *Client) GetEpisodes(show types.IDs) ([]types.EpisodeNumbers, error) {
+	id := show.Trakt
+	if id == "" {
+		id = show.Slug
+	}
+	if id == "" {
+		id = show.IMDB
+	}
+	if id == "" {
+		return nil, errors.New("show has no Trakt, slug or IMDB ID")
+	}
+	var seasons []Season
+	query := url.Values{"extended": {"full,episodes"}}
+	if _, _, err := t.get("/shows/"+url.PathEscape(id)+"/seasons", query, &seasons); err != nil {
+		return nil, fmt.Errorf("failed to get episodes of show %s: %w", id, err)
+	}
+	var episodes []types.EpisodeNumbers
+	for _, season := range seasons {
+		for _, episode := range season.Episodes {
+			numbers := types.EpisodeNumbers{
+				Season:   season.Number,
+				Number:   episode.Number,
+				Absolute: episode.NumberAbs,
+			}
+			if episode.FirstAired != nil {
+				numbers.AirDate = episode.FirstAired.Format("2006-01-02")
+			}
+			episodes = append(episodes, numbers)
+		}
+	}
+	return episodes, nil
+}
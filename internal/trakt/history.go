@@ -0,0 +1,233 @@
+package trakt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// historyBatchSize is the number of plays sent per /sync/history request
+const historyBatchSize = 100
+
+// SyncHistory syncs a single completed item to Trakt
+func (t *Client) SyncHistory(session types.MediaSession) error {
+	_, notFound, err := t.SyncHistoryBatch([]types.MediaSession{session})
+	if err != nil {
+		return err
+	}
+	if len(notFound) > 0 {
+		return fmt.Errorf("%w on trakt for %s", registry.ErrNotFound, types.GetMediaKey(session))
+	}
+	return nil
+}
+
+// SyncHistoryBatch adds completed plays to the user's history in batches, each with its watch time.
+// It returns how many plays, from the first, were sent before an error, and the plays Trakt could not match.
+func (t *Client) SyncHistoryBatch(sessions []types.MediaSession) (int, []types.MediaSession, error) {
+	var notFound []types.MediaSession
+	for start := 0; start < len(sessions); start += historyBatchSize {
+		batch := sessions[start:min(start+historyBatchSize, len(sessions))]
+		result, missing, err := t.sendHistory("/sync/history", batch)
+		if err != nil {
+			return start, notFound, err
+		}
+		notFound = append(notFound, missing...)
+		t.checkAdded(batch, missing, result)
+	}
+	return len(sessions), notFound, nil
+}
+
+// checkAdded warns when Trakt added fewer plays than it matched. Trakt does not list the unknown
+// episode numbers of a show it found, so the plays it dropped cannot be told apart.
+func (t *Client) checkAdded(batch, notFound []types.MediaSession, result SyncResponse) {
+	sent := make(map[string]int)
+	for _, session := range batch {
+		sent[session.Type]++
+	}
+	for _, session := range notFound {
+		sent[session.Type]--
+	}
+	if result.Added.Movies < sent["movie"] {
+		t.logger.Warn().Msgf("Trakt added %d of %d movie plays", result.Added.Movies, sent["movie"])
+	}
+	if result.Added.Episodes < sent["episode"] {
+		t.logger.Warn().Msgf("Trakt added %d of %d episode plays, some episode numbers may be unknown to Trakt", result.Added.Episodes, sent["episode"])
+	}
+}
+
+// MarkUnwatched removes every play of a movie or episode from the user's history
+func (t *Client) MarkUnwatched(session types.MediaSession) error {
+	// Without a watch time Trakt removes all plays of the item
+	session.ViewedAt = 0
+	_, notFound, err := t.sendHistory("/sync/history/remove", []types.MediaSession{session})
+	if err != nil {
+		return err
+	}
+	if len(notFound) > 0 {
+		return fmt.Errorf("trakt could not match %s", types.GetMediaKey(session))
+	}
+	return nil
+}
+
+// sendHistory posts one batch to /sync/history or /sync/history/remove and maps Trakt's
+// not_found lists back to the plays
+func (t *Client) sendHistory(path string, sessions []types.MediaSession) (SyncResponse, []types.MediaSession, error) {
+	var result SyncResponse
+	payload, skipped := historyPayload(sessions)
+	if len(skipped) == len(sessions) {
+		return result, skipped, nil
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to marshal history data: %w", err)
+	}
+	req, err := http.NewRequest("POST", t.APIBaseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := t.do(req)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return result, nil, fmt.Errorf("trakt API error %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	notFound := skipped
+	for _, session := range sessions {
+		if result.NotFound.matches(session) {
+			notFound = append(notFound, session)
+		}
+	}
+	if len(notFound) > 0 {
+		t.logger.Debug().Msgf("Trakt did not find %d of %d history items", len(notFound), len(sessions))
+	}
+	return result, notFound, nil
+}
+
+// historyPayload groups plays the way /sync/history expects them. Episodes are sent under
+// their show with season and episode numbers, so Trakt can match them without episode IDs.
+// Plays that cannot be identified at all are returned rather than sent.
+func historyPayload(sessions []types.MediaSession) (map[string]interface{}, []types.MediaSession) {
+	movies := make([]map[string]interface{}, 0)
+	episodes := make([]map[string]interface{}, 0)
+	shows := make([]map[string]interface{}, 0)
+	showIndex := make(map[string]int)
+	seasons := make([]map[int][]map[string]interface{}, 0)
+	var skipped []types.MediaSession
+
+	for _, session := range sessions {
+		entry := map[string]interface{}{}
+		if session.ViewedAt > 0 {
+			entry["watched_at"] = time.Unix(session.ViewedAt, 0).UTC().Format(time.RFC3339)
+		}
+		switch {
+		case session.Type == "movie":
+			entry["title"] = session.Title
+			entry["year"] = session.Year
+			entry["ids"] = traktIDs(session.IDs)
+			movies = append(movies, entry)
+		case session.Type == "episode" && showKey(session) != "":
+			key := showKey(session)
+			index, ok := showIndex[key]
+			if !ok {
+				index = len(shows)
+				showIndex[key] = index
+				shows = append(shows, showEntry(session))
+				seasons = append(seasons, make(map[int][]map[string]interface{}))
+			}
+			entry["number"] = session.EpisodeNum
+			seasons[index][session.SeasonNum] = append(seasons[index][session.SeasonNum], entry)
+		case session.Type == "episode" && !traktIDs(session.IDs).isZero():
+			entry["ids"] = traktIDs(session.IDs)
+			episodes = append(episodes, entry)
+		default:
+			skipped = append(skipped, session)
+		}
+	}
+
+	for i, show := range shows {
+		numbers := make([]int, 0, len(seasons[i]))
+		for number := range seasons[i] {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		showSeasons := make([]map[string]interface{}, 0, len(numbers))
+		for _, number := range numbers {
+			showSeasons = append(showSeasons, map[string]interface{}{
+				"number":   number,
+				"episodes": seasons[i][number],
+			})
+		}
+		show["seasons"] = showSeasons
+	}
+
+	return map[string]interface{}{
+		"movies":   movies,
+		"episodes": episodes,
+		"shows":    shows,
+	}, skipped
+}
+
+// showKey identifies the show of an episode within a batch
+func showKey(session types.MediaSession) string {
+	if ids := traktIDs(session.ShowIDs); !ids.isZero() {
+		return fmt.Sprintf("%+v", ids)
+	}
+	if session.ShowTitle != "" {
+		return "title:" + session.ShowTitle
+	}
+	return ""
+}
+
+// showEntry is the show object of an episode, with whatever IDs are known
+func showEntry(session types.MediaSession) map[string]interface{} {
+	show := map[string]interface{}{"ids": traktIDs(session.ShowIDs)}
+	if session.ShowTitle != "" {
+		show["title"] = session.ShowTitle
+	}
+	return show
+}
+
+// matches reports whether a play is among the items Trakt could not find
+func (n NotFound) matches(session types.MediaSession) bool {
+	switch session.Type {
+	case "movie":
+		for _, movie := range n.Movies {
+			if movie.IDs.shares(traktIDs(session.IDs)) {
+				return true
+			}
+			if movie.IDs.isZero() && movie.Title == session.Title && movie.Year == session.Year {
+				return true
+			}
+		}
+	case "episode":
+		for _, show := range n.Shows {
+			if show.IDs.shares(traktIDs(session.ShowIDs)) {
+				return true
+			}
+			if show.IDs.isZero() && show.Title == session.ShowTitle {
+				return true
+			}
+		}
+		for _, episode := range n.Episodes {
+			if episode.IDs.shares(traktIDs(session.IDs)) {
+				return true
+			}
+		}
+	}
+	return false
+}
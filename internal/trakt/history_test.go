@@ -0,0 +1,97 @@
+package trakt
+
+import (
+	"encoding/json"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"testing"
+)
+
+// assertPayload compares a request body with the JSON Trakt is expected to receive
+func assertPayload(t *testing.T, payload map[string]interface{}, want string) {
+	t.Helper()
+	got, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(wantValue)
+	if gotJSON, _ := json.Marshal(gotValue); string(gotJSON) != string(wantJSON) {
+		t.Errorf("payload = %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestHistoryPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		sessions []types.MediaSession
+		want     string
+		skipped  int
+	}{
+		{
+			name:     "empty",
+			sessions: nil,
+			want:     `{"movies": [], "episodes": [], "shows": []}`,
+		},
+		{
+			name: "movie",
+			sessions: []types.MediaSession{
+				{Type: "movie", Title: "Alien", Year: 1979, ViewedAt: 1700000000, IDs: types.IDs{TMDB: "348", IMDB: "tt0078748"}},
+			},
+			want: `{"movies": [{"title": "Alien", "year": 1979, "watched_at": "2023-11-14T22:13:20Z", "ids": {"imdb": "tt0078748", "tmdb": 348}}], "episodes": [], "shows": []}`,
+		},
+		{
+			name: "episodes grouped by show and season",
+			sessions: []types.MediaSession{
+				{Type: "episode", ShowTitle: "Lost", SeasonNum: 2, EpisodeNum: 1, ShowIDs: types.IDs{TVDB: "73739"}},
+				{Type: "episode", ShowTitle: "Lost", SeasonNum: 1, EpisodeNum: 2, ShowIDs: types.IDs{TVDB: "73739"}},
+				{Type: "episode", ShowTitle: "Lost", SeasonNum: 1, EpisodeNum: 1, ShowIDs: types.IDs{TVDB: "73739"}},
+			},
+			want: `{"movies": [], "episodes": [], "shows": [{"title": "Lost", "ids": {"tvdb": 73739}, "seasons": [
+				{"number": 1, "episodes": [{"number": 2}, {"number": 1}]},
+				{"number": 2, "episodes": [{"number": 1}]}
+			]}]}`,
+		},
+		{
+			name: "shows sharing a title with other IDs",
+			sessions: []types.MediaSession{
+				{Type: "episode", ShowTitle: "Doctor Who", SeasonNum: 1, EpisodeNum: 1, ShowIDs: types.IDs{TVDB: "76107"}},
+				{Type: "episode", ShowTitle: "Doctor Who", SeasonNum: 1, EpisodeNum: 1, ShowIDs: types.IDs{TVDB: "78804"}},
+			},
+			want: `{"movies": [], "episodes": [], "shows": [
+				{"title": "Doctor Who", "ids": {"tvdb": 76107}, "seasons": [{"number": 1, "episodes": [{"number": 1}]}]},
+				{"title": "Doctor Who", "ids": {"tvdb": 78804}, "seasons": [{"number": 1, "episodes": [{"number": 1}]}]}
+			]}`,
+		},
+		{
+			name: "episode known only by its IDs",
+			sessions: []types.MediaSession{
+				{Type: "episode", SeasonNum: 1, EpisodeNum: 1, IDs: types.IDs{Trakt: "73482"}},
+			},
+			want: `{"movies": [], "episodes": [{"ids": {"trakt": 73482}}], "shows": []}`,
+		},
+		{
+			name: "items Trakt cannot take",
+			sessions: []types.MediaSession{
+				{Type: "episode", SeasonNum: 1, EpisodeNum: 1},
+				{Type: "track", Title: "Song"},
+			},
+			want:    `{"movies": [], "episodes": [], "shows": []}`,
+			skipped: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, skipped := historyPayload(tt.sessions)
+			assertPayload(t, payload, tt.want)
+			if len(skipped) != tt.skipped {
+				t.Errorf("skipped %d items, want %d", len(skipped), tt.skipped)
+			}
+		})
+	}
+}
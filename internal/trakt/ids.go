@@ -0,0 +1,53 @@
+package trakt
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"strconv"
+)
+
+// toIDs converts the IDs of a Trakt item
+func (i IDs) toIDs() types.IDs {
+	ids := types.IDs{
+		IMDB: i.IMDB,
+		Slug: i.Slug,
+	}
+	if i.Trakt > 0 {
+		ids.Trakt = strconv.Itoa(i.Trakt)
+	}
+	if i.TMDB > 0 {
+		ids.TMDB = strconv.Itoa(i.TMDB)
+	}
+	if i.TVDB > 0 {
+		ids.TVDB = strconv.Itoa(i.TVDB)
+	}
+	return ids
+}
+
+// traktIDs converts IDs for a request, leaving out those Trakt does not know
+func traktIDs(ids types.IDs) IDs {
+	// Malformed numeric IDs are dropped rather than sent as 0
+	trakt, _ := strconv.Atoi(ids.Trakt)
+	tmdb, _ := strconv.Atoi(ids.TMDB)
+	tvdb, _ := strconv.Atoi(ids.TVDB)
+	return IDs{
+		Trakt: trakt,
+		Slug:  ids.Slug,
+		IMDB:  ids.IMDB,
+		TMDB:  tmdb,
+		TVDB:  tvdb,
+	}
+}
+
+// isZero reports whether no ID is set
+func (i IDs) isZero() bool {
+	return i == IDs{}
+}
+
+// shares reports whether both sets have an ID in common
+func (i IDs) shares(other IDs) bool {
+	return (i.Trakt > 0 && i.Trakt == other.Trakt) ||
+		(i.Slug != "" && i.Slug == other.Slug) ||
+		(i.IMDB != "" && i.IMDB == other.IMDB) ||
+		(i.TMDB > 0 && i.TMDB == other.TMDB) ||
+		(i.TVDB > 0 && i.TVDB == other.TVDB)
+}
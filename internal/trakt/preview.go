@@ -0,0 +1,37 @@
+package trakt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+)
+
+// Preview returns the JSON body a write for session would send. Live scrobbles get the scrobble body,
+// every other write the history body, which identifies items the same way as the ratings, collection
+// and watchlist endpoints.
+func (t *Client) Preview(session types.MediaSession, action string) (string, error) {
+	var payload interface{}
+	switch action {
+	case "start", "pause", "stop":
+		request, err := scrobblePayload(session)
+		if err != nil {
+			return "", err
+		}
+		payload = request
+	default:
+		if session.Type != "movie" && session.Type != "episode" {
+			return "", fmt.Errorf("%w: %s", registry.ErrUnsupported, session.Type)
+		}
+		body, skipped := historyPayload([]types.MediaSession{session})
+		if len(skipped) > 0 {
+			return "", fmt.Errorf("no IDs or show to identify %s on Trakt", session.Title)
+		}
+		payload = body
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return string(data), nil
+}
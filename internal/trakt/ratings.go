@@ -0,0 +1,105 @@
+package trakt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+	"time"
+)
+
+// GetRatings returns the user's movie and episode ratings
+func (t *Client) GetRatings() ([]types.Rating, error) {
+	ratings := make([]types.Rating, 0)
+	for _, mediaType := range []string{"movies", "episodes"} {
+		var items []RatingItem
+		if _, _, err := t.get("/sync/ratings/"+mediaType, nil, &items); err != nil {
+			return nil, fmt.Errorf("failed to get %s ratings: %w", mediaType, err)
+		}
+		for _, item := range items {
+			session, ok := t.toMediaSession(item.Type, item.Movie, item.Show, item.Episode)
+			if !ok || item.Rating <= 0 {
+				continue
+			}
+			ratings = append(ratings, types.Rating{
+				Session: session,
+				Value:   min(item.Rating, 10),
+				RatedAt: item.RatedAt.Unix(),
+			})
+		}
+	}
+	t.logger.Debug().
+		Int("count", len(ratings)).
+		Msgf("Retrieved ratings from %s", t.name)
+	return ratings, nil
+}
+
+// SetRating rates a movie or episode, keeping the time it was rated on the other server
+func (t *Client) SetRating(rating types.Rating) error {
+	session := rating.Session
+	ratedAt := time.Now()
+	if rating.RatedAt > 0 {
+		ratedAt = time.Unix(rating.RatedAt, 0)
+	}
+	item := map[string]interface{}{
+		"rating":   rating.Value,
+		"rated_at": ratedAt.UTC().Format(time.RFC3339),
+	}
+
+	var payload map[string]interface{}
+	switch {
+	case session.Type == "movie":
+		item["title"] = session.Title
+		item["year"] = session.Year
+		item["ids"] = traktIDs(session.IDs)
+		payload = map[string]interface{}{"movies": []interface{}{item}}
+	case session.Type == "episode" && !traktIDs(session.IDs).isZero():
+		item["ids"] = traktIDs(session.IDs)
+		payload = map[string]interface{}{"episodes": []interface{}{item}}
+	case session.Type == "episode":
+		// Without episode IDs Trakt finds the episode through the show
+		item["number"] = session.EpisodeNum
+		payload = map[string]interface{}{
+			"shows": []interface{}{
+				map[string]interface{}{
+					"title": session.ShowTitle,
+					"ids":   traktIDs(session.ShowIDs),
+					"seasons": []interface{}{
+						map[string]interface{}{
+							"number":   session.SeasonNum,
+							"episodes": []interface{}{item},
+						},
+					},
+				},
+			},
+		}
+	default:
+		return fmt.Errorf("unsupported media type: %s", session.Type)
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rating: %w", err)
+	}
+	req, err := http.NewRequest("POST", t.APIBaseURL+"/sync/ratings", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := t.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("trakt API error %d: %s", resp.StatusCode, string(body))
+	}
+	t.logger.Trace().
+		Str("title", session.Title).
+		Int("rating", rating.Value).
+		Msgf("Rated in %s", t.name)
+	return nil
+}
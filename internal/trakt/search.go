@@ -0,0 +1,43 @@
+package trakt
+
+import (
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"net/url"
+)
+
+// SearchIDs looks up a movie, show or episode by each of its external IDs in turn and returns all its IDs,
+// and those of its show for an episode. found is false when Trakt knows none of the IDs.
+func (t *Client) SearchIDs(mediaType string, ids types.IDs) (types.IDs, types.IDs, bool, error) {
+	if mediaType != "movie" && mediaType != "show" && mediaType != "episode" {
+		return types.IDs{}, types.IDs{}, false, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+	for _, id := range []struct{ kind, value string }{
+		{"trakt", ids.Trakt},
+		{"imdb", ids.IMDB},
+		{"tmdb", ids.TMDB},
+		{"tvdb", ids.TVDB},
+	} {
+		if id.value == "" {
+			continue
+		}
+		var results []SearchResult
+		query := url.Values{"type": {mediaType}}
+		if _, _, err := t.get(fmt.Sprintf("/search/%s/%s", id.kind, url.PathEscape(id.value)), query, &results); err != nil {
+			return types.IDs{}, types.IDs{}, false, fmt.Errorf("failed to search %s %s: %w", id.kind, id.value, err)
+		}
+		for _, result := range results {
+			switch {
+			case result.Type != mediaType:
+				continue
+			case result.Movie != nil:
+				return result.Movie.IDs.toIDs(), types.IDs{}, true, nil
+			case result.Episode != nil && result.Show != nil:
+				return result.Episode.IDs.toIDs(), result.Show.IDs.toIDs(), true, nil
+			case result.Show != nil && mediaType == "show":
+				return result.Show.IDs.toIDs(), types.IDs{}, true, nil
+			}
+		}
+	}
+	return types.IDs{}, types.IDs{}, false, nil
+}
@@ -0,0 +1,172 @@
+package trakt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// historyPageSize is the number of plays requested per /sync/history page
+const historyPageSize = 100
+
+// get decodes the response of a GET request into v. It reports false when Trakt returns no content.
+func (t *Client) get(path string, query url.Values, v any) (http.Header, bool, error) {
+	_url := t.APIBaseURL + path
+	if len(query) > 0 {
+		_url += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("GET", _url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := t.do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return resp.Header, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, false, fmt.Errorf("trakt API error %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp.Header, true, nil
+}
+
+// Connect checks the access token and looks up the authenticated user
+func (t *Client) Connect() error {
+	var settings UserSettings
+	if _, _, err := t.get("/users/settings", nil, &settings); err != nil {
+		return fmt.Errorf("failed to connect to Trakt: %w", err)
+	}
+	t.user = types.User{
+		ID:       settings.User.IDs.Slug,
+		Username: settings.User.Username,
+	}
+	t.logger.Info().Msgf("Connected to Trakt as %s", t.user.Username)
+	return nil
+}
+
+// GetSessions returns what the user is watching now, from any app reporting to Trakt
+func (t *Client) GetSessions() ([]types.MediaSession, error) {
+	var watching Watching
+	_, ok, err := t.get("/users/me/watching", nil, &watching)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watching: %w", err)
+	}
+	if !ok {
+		return []types.MediaSession{}, nil
+	}
+
+	session, ok := t.toMediaSession(watching.Type, watching.Movie, watching.Show, watching.Episode)
+	if !ok {
+		return []types.MediaSession{}, nil
+	}
+	// Trakt only knows when playback started and when it is expected to end
+	duration := watching.ExpiresAt.Sub(watching.StartedAt)
+	elapsed := min(time.Since(watching.StartedAt), duration)
+	session.SessionID = fmt.Sprintf("trakt-%d", watching.StartedAt.Unix())
+	session.State = "playing"
+	session.Duration = duration.Milliseconds()
+	session.ViewOffset = elapsed.Milliseconds()
+	if duration > 0 {
+		session.Progress = float64(elapsed) / float64(duration) * 100
+	}
+	return []types.MediaSession{session}, nil
+}
+
+// GetWatchHistory returns the full watch history of the user
+func (t *Client) GetWatchHistory() ([]types.MediaSession, error) {
+	return t.GetWatchHistorySince(time.Time{})
+}
+
+// GetWatchHistorySince returns the plays at or after since. It checks /sync/last_activities
+// first, so polling costs a single request while nothing has been watched.
+func (t *Client) GetWatchHistorySince(since time.Time) ([]types.MediaSession, error) {
+	if !since.IsZero() {
+		var activities LastActivities
+		if _, _, err := t.get("/sync/last_activities", nil, &activities); err != nil {
+			return nil, fmt.Errorf("failed to get last activities: %w", err)
+		}
+		if activities.Movies.WatchedAt.Before(since) && activities.Episodes.WatchedAt.Before(since) {
+			return []types.MediaSession{}, nil
+		}
+	}
+
+	history := make([]types.MediaSession, 0)
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("page", strconv.Itoa(page))
+		query.Set("limit", strconv.Itoa(historyPageSize))
+		if !since.IsZero() {
+			query.Set("start_at", since.UTC().Format(time.RFC3339))
+		}
+		var items []HistoryItem
+		header, _, err := t.get("/sync/history", query, &items)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get history: %w", err)
+		}
+		for _, item := range items {
+			if item.WatchedAt.Before(since) {
+				continue
+			}
+			session, ok := t.toMediaSession(item.Type, item.Movie, item.Show, item.Episode)
+			if !ok {
+				continue
+			}
+			session.SessionID = fmt.Sprintf("trakt-%d", item.ID)
+			session.State = "stopped"
+			session.Progress = 100
+			session.ViewedAt = item.WatchedAt.Unix()
+			history = append(history, session)
+		}
+
+		pageCount, _ := strconv.Atoi(header.Get("X-Pagination-Page-Count"))
+		if len(items) < historyPageSize || page >= pageCount {
+			break
+		}
+	}
+
+	t.logger.Debug().
+		Int("count", len(history)).
+		Msgf("Retrieved watch history from %s", t.name)
+	return history, nil
+}
+
+// toMediaSession converts a Trakt movie or episode
+func (t *Client) toMediaSession(mediaType string, movie, show, episode *MediaItem) (types.MediaSession, bool) {
+	session := types.MediaSession{
+		Type:   mediaType,
+		User:   t.user,
+		Source: t.name,
+	}
+	switch {
+	case mediaType == "movie" && movie != nil:
+		session.Title = movie.Title
+		session.Year = movie.Year
+		session.IDs = movie.IDs.toIDs()
+		session.LibraryType = "movie"
+	case mediaType == "episode" && episode != nil && show != nil:
+		session.Title = episode.Title
+		session.EpisodeTitle = episode.Title
+		session.ShowTitle = show.Title
+		session.SeasonNum = episode.Season
+		session.EpisodeNum = episode.Number
+		session.IDs = episode.IDs.toIDs()
+		session.ShowIDs = show.IDs.toIDs()
+		session.LibraryType = "show"
+	default:
+		return session, false
+	}
+	return session, true
+}
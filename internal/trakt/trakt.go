@@ -2,10 +2,12 @@ package trakt
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/registry"
 	"github.com/sirrobot01/scroblarr/internal/types"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
 	"github.com/sirrobot01/scroblarr/pkg/request"
@@ -16,76 +18,92 @@ import (
 
 type Client struct {
 	APIBaseURL string
+	name       string
+	server     config.Server
 	config     *config.Trakt
 	logger     zerolog.Logger
 	client     *request.Client
+	user       types.User // Authenticated user, set by Connect
 }
 
-func (t *Client) GetSyncFrom() bool {
-	return false
+// Trakt's published API limits, used unless the server sets its own
+const (
+	DefaultRateLimit      = "1000/5m"
+	DefaultWriteRateLimit = "1/s"
+)
+
+func init() {
+	registry.Register(registry.Definition{
+		ServerType: config.ServerType{
+			Name:   config.TraktTarget,
+			Label:  "Trakt",
+			Fields: config.RateLimitFields,
+			Capabilities: []config.Capability{
+				config.CapabilitySessions,
+				config.CapabilityHistory,
+				config.CapabilityScrobble,
+				config.CapabilityHistoryWrite,
+				config.CapabilityRatings,
+				config.CapabilityWatchlist,
+				config.CapabilityCollection,
+				config.CapabilityUnwatch,
+			},
+		},
+		New: func(name string, cfg config.Server) (registry.Server, error) {
+			return New(name, cfg)
+		},
+	})
 }
 
-func New() *Client {
-	cfg := config.Get().Trakt
+// New creates a Trakt client using the account authenticated from the web UI
+func New(name string, server config.Server) (*Client, error) {
+	cfg := loadLogin()
 	if cfg == nil {
-		return nil
+		return nil, fmt.Errorf("trakt is not authenticated")
 	}
 	headers := map[string]string{
 		"Content-Type":      "application/json",
 		"trakt-api-version": "2",
-		"Authorization":     "Bearer " + cfg.AccessToken,
-		"trakt-api-key":     "4ee97aae28ec4797b76a7c97d2655286e3c113124028339c9c08d9ab12a2f81a",
+		"trakt-api-key":     config.Get().GetTraktClientID(),
 	}
 	_logger := logger.NewLogger("trakt")
 	client := request.New(
 		request.WithHeaders(headers),
 		request.WithLogger(_logger),
+		request.WithRateLimiter(config.NewRateLimiter(cmp.Or(server.RateLimit, DefaultRateLimit))),
+		request.WithWriteRateLimiter(config.NewRateLimiter(cmp.Or(server.WriteRateLimit, DefaultWriteRateLimit))),
 	)
 	c := &Client{
-		APIBaseURL: "https://api.trakt.tv",
+		APIBaseURL: config.Get().GetTraktAPIURL(),
+		name:       name,
+		server:     server,
 		config:     cfg,
 		logger:     _logger,
 		client:     client,
 	}
 
-	// Connect
-	return c
+	if err := c.Connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetName returns the name of the server
+func (t *Client) GetName() string {
+	return t.name
+}
+
+func (t *Client) GetConfig() config.Server {
+	return t.server
 }
 
 // Scrobble sends a scrobble update to Trakt
 func (t *Client) Scrobble(session types.MediaSession, action string) error {
 	url := fmt.Sprintf("%s/scrobble/%s", t.APIBaseURL, action)
 
-	// Prepare request body
-	payload := ScrobbleRequest{
-		Progress:   session.Progress,
-		AppVersion: fmt.Sprintf("scroblarr/%s", version.GetInfo()),
-	}
-
-	// Set the appropriate media type
-	if session.Type == "movie" {
-		payload.Movie = &Movie{
-			Title: session.Title,
-			Year:  session.Year,
-			IDs:   make(map[string]string),
-		}
-		if session.IMDBID != "" {
-			payload.Movie.IDs["imdb"] = session.IMDBID
-		}
-	} else if session.Type == "episode" {
-		payload.Episode = &Episode{
-			Title:  session.EpisodeTitle,
-			Season: session.SeasonNum,
-			Number: session.EpisodeNum,
-			IDs:    make(map[string]string),
-		}
-		payload.Show = &Show{
-			Title: session.ShowTitle,
-			IDs:   make(map[string]string),
-		}
-		if session.TVDBID != "" {
-			payload.Show.IDs["tvdb"] = session.TVDBID
-		}
+	payload, err := scrobblePayload(session)
+	if err != nil {
+		return err
 	}
 
 	// Marshal to JSON
@@ -100,107 +118,52 @@ func (t *Client) Scrobble(session types.MediaSession, action string) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := t.client.Do(req)
+	resp, err := t.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		fmt.Println(string(bodyBytes))
-		return fmt.Errorf("trakt API error: %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("trakt API error %d: %s", resp.StatusCode, string(body))
 	}
 
 	return nil
 }
 
-// SyncHistory syncs a single completed item to Trakt
-func (t *Client) SyncHistory(session types.MediaSession) error {
-	url := fmt.Sprintf("%s/sync/history", t.APIBaseURL)
-
-	// Prepare history data based on media type
-	var historyData map[string]interface{}
+// scrobblePayload is the body of a scrobble request for a movie or episode
+func scrobblePayload(session types.MediaSession) (ScrobbleRequest, error) {
+	payload := ScrobbleRequest{
+		Progress:   session.Progress,
+		AppVersion: fmt.Sprintf("scroblarr/%s", version.GetInfo()),
+	}
 
+	// Set the appropriate media type
 	if session.Type == "movie" {
-		movies := []map[string]interface{}{
-			{
-				"title": session.Title,
-				"year":  session.Year,
-				"ids":   map[string]string{},
-			},
-		}
-
-		if session.IMDBID != "" {
-			movies[0]["ids"].(map[string]string)["imdb"] = session.IMDBID
-		}
-
-		historyData = map[string]interface{}{
-			"movies": movies,
+		payload.Movie = &Movie{
+			Title: session.Title,
+			Year:  session.Year,
+			IDs:   traktIDs(session.IDs),
 		}
 	} else if session.Type == "episode" {
-		episodes := []map[string]interface{}{
-			{
-				"title":  session.EpisodeTitle,
-				"season": session.SeasonNum,
-				"number": session.EpisodeNum,
-				"ids":    map[string]string{},
-			},
+		payload.Episode = &Episode{
+			Title:  session.EpisodeTitle,
+			Season: session.SeasonNum,
+			Number: session.EpisodeNum,
+			IDs:    traktIDs(session.IDs),
 		}
-
-		historyData = map[string]interface{}{
-			"episodes": episodes,
+		payload.Show = &Show{
+			Title: session.ShowTitle,
+			IDs:   traktIDs(session.ShowIDs),
 		}
 	} else {
-		return fmt.Errorf("unsupported media type: %s", session.Type)
-	}
-
-	// Marshal to JSON
-	jsonData, err := json.Marshal(historyData)
-	if err != nil {
-		return fmt.Errorf("failed to marshal history data: %w", err)
-	}
-
-	// Prepare request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	resp, err := t.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return ScrobbleRequest{}, fmt.Errorf("%w: %s", registry.ErrUnsupported, session.Type)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("trakt API error: %d", resp.StatusCode)
-	}
-
-	return nil
-}
-
-// GetSessions returns currently active sessions from Emby
-func (t *Client) GetSessions() ([]types.MediaSession, error) {
-	// This would need to be implemented
-	return []types.MediaSession{}, nil
-}
-
-// GetWatchHistory returns the watch history from Emby
-func (t *Client) GetWatchHistory() ([]types.MediaSession, error) {
-	// This would need to be implemented
-	return []types.MediaSession{}, nil
+	return payload, nil
 }
 
 // GetServerType returns the type of this server
 func (t *Client) GetServerType() string {
 	return "trakt"
 }
-
-func (t *Client) GetSyncTo() []string {
-	return []string{}
-}
-
-func (t *Client) Connect() error {
-	// This would need to be implemented
-	return nil
-}
@@ -1,5 +1,7 @@
 package trakt
 
+import "time"
+
 // ScrobbleRequest represents a request to Trakt's scrobble API
 type ScrobbleRequest struct {
 	Movie      *Movie   `json:"movie,omitempty"`
@@ -11,21 +13,139 @@ type ScrobbleRequest struct {
 
 // Movie represents a movie in Trakt's API
 type Movie struct {
-	Title string            `json:"title"`
-	Year  int               `json:"year,omitempty"`
-	IDs   map[string]string `json:"ids"`
+	Title string `json:"title"`
+	Year  int    `json:"year,omitempty"`
+	IDs   IDs    `json:"ids"`
 }
 
 // Episode represents an episode in Trakt's API
 type Episode struct {
-	Title  string            `json:"title"`
-	Season int               `json:"season"`
-	Number int               `json:"number"`
-	IDs    map[string]string `json:"ids,omitempty"`
+	Title      string     `json:"title"`
+	Season     int        `json:"season"`
+	Number     int        `json:"number"`
+	NumberAbs  int        `json:"number_abs,omitempty"`  // Only with extended info
+	FirstAired *time.Time `json:"first_aired,omitempty"` // Only with extended info
+	IDs        IDs        `json:"ids"`
+}
+
+// Season is a season of a show with its episodes
+type Season struct {
+	Number   int       `json:"number"`
+	Episodes []Episode `json:"episodes"`
 }
 
 // Show represents a show in Trakt's API
 type Show struct {
-	Title string            `json:"title"`
-	IDs   map[string]string `json:"ids,omitempty"`
+	Title string `json:"title"`
+	IDs   IDs    `json:"ids"`
+}
+
+// IDs are the external IDs Trakt returns for movies, shows and episodes
+type IDs struct {
+	Trakt int    `json:"trakt,omitempty"`
+	Slug  string `json:"slug,omitempty"`
+	IMDB  string `json:"imdb,omitempty"`
+	TMDB  int    `json:"tmdb,omitempty"`
+	TVDB  int    `json:"tvdb,omitempty"`
+}
+
+// MediaItem is a movie, show or episode as returned by Trakt
+type MediaItem struct {
+	Title   string `json:"title"`
+	Year    int    `json:"year,omitempty"`
+	Season  int    `json:"season,omitempty"`
+	Number  int    `json:"number,omitempty"`
+	Runtime int    `json:"runtime,omitempty"` // Minutes
+	IDs     IDs    `json:"ids"`
+}
+
+// Watching is the response of /users/{id}/watching
+type Watching struct {
+	ExpiresAt time.Time  `json:"expires_at"`
+	StartedAt time.Time  `json:"started_at"`
+	Action    string     `json:"action"` // "scrobble" or "checkin"
+	Type      string     `json:"type"`   // "movie" or "episode"
+	Movie     *MediaItem `json:"movie,omitempty"`
+	Episode   *MediaItem `json:"episode,omitempty"`
+	Show      *MediaItem `json:"show,omitempty"`
+}
+
+// HistoryItem is a single play from /sync/history
+type HistoryItem struct {
+	ID        int64      `json:"id"`
+	WatchedAt time.Time  `json:"watched_at"`
+	Action    string     `json:"action"` // "scrobble", "checkin" or "watch"
+	Type      string     `json:"type"`   // "movie" or "episode"
+	Movie     *MediaItem `json:"movie,omitempty"`
+	Episode   *MediaItem `json:"episode,omitempty"`
+	Show      *MediaItem `json:"show,omitempty"`
+}
+
+// RatingItem is a single rating from /sync/ratings
+type RatingItem struct {
+	RatedAt time.Time  `json:"rated_at"`
+	Rating  int        `json:"rating"` // 1 to 10
+	Type    string     `json:"type"`   // "movie" or "episode"
+	Movie   *MediaItem `json:"movie,omitempty"`
+	Episode *MediaItem `json:"episode,omitempty"`
+	Show    *MediaItem `json:"show,omitempty"`
+}
+
+// WatchlistItem is a single movie or show from /sync/watchlist
+type WatchlistItem struct {
+	ListedAt time.Time  `json:"listed_at"`
+	Type     string     `json:"type"` // "movie" or "show"
+	Movie    *MediaItem `json:"movie,omitempty"`
+	Show     *MediaItem `json:"show,omitempty"`
+}
+
+// SearchResult is a single result of /search/{id_type}/{id}
+type SearchResult struct {
+	Type    string     `json:"type"` // "movie", "show" or "episode"
+	Movie   *MediaItem `json:"movie,omitempty"`
+	Show    *MediaItem `json:"show,omitempty"`
+	Episode *MediaItem `json:"episode,omitempty"`
+}
+
+// SyncResponse is the response of the /sync endpoints that add or remove items, trimmed to what is used
+type SyncResponse struct {
+	Added struct {
+		Movies   int `json:"movies"`
+		Episodes int `json:"episodes"`
+	} `json:"added"`
+	NotFound NotFound `json:"not_found"`
+}
+
+// NotFound lists the items of a /sync request Trakt could not match
+type NotFound struct {
+	Movies   []MediaItem `json:"movies"`
+	Shows    []MediaItem `json:"shows"`
+	Seasons  []MediaItem `json:"seasons"`
+	Episodes []MediaItem `json:"episodes"`
+}
+
+// Count returns the number of items not found
+func (n NotFound) Count() int {
+	return len(n.Movies) + len(n.Shows) + len(n.Seasons) + len(n.Episodes)
+}
+
+// LastActivities is the response of /sync/last_activities, trimmed to what is used
+type LastActivities struct {
+	All    time.Time `json:"all"`
+	Movies struct {
+		WatchedAt time.Time `json:"watched_at"`
+	} `json:"movies"`
+	Episodes struct {
+		WatchedAt time.Time `json:"watched_at"`
+	} `json:"episodes"`
+}
+
+// UserSettings is the response of /users/settings, trimmed to the user
+type UserSettings struct {
+	User struct {
+		Username string `json:"username"`
+		IDs      struct {
+			Slug string `json:"slug"`
+		} `json:"ids"`
+	} `json:"user"`
 }
@@ -0,0 +1,89 @@
+package trakt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"io"
+	"net/http"
+)
+
+// GetWatchlist returns the movies and shows on the user's watchlist
+func (t *Client) GetWatchlist() ([]types.MediaSession, error) {
+	watchlist := make([]types.MediaSession, 0)
+	for _, mediaType := range []string{"movies", "shows"} {
+		var items []WatchlistItem
+		if _, _, err := t.get("/sync/watchlist/"+mediaType, nil, &items); err != nil {
+			return nil, fmt.Errorf("failed to get %s watchlist: %w", mediaType, err)
+		}
+		for _, item := range items {
+			media := item.Movie
+			if item.Type == "show" {
+				media = item.Show
+			}
+			if media == nil {
+				continue
+			}
+			session := types.MediaSession{
+				Type:        item.Type,
+				Title:       media.Title,
+				Year:        media.Year,
+				IDs:         media.IDs.toIDs(),
+				User:        t.user,
+				Source:      t.name,
+				LibraryType: item.Type,
+			}
+			watchlist = append(watchlist, session)
+		}
+	}
+	t.logger.Debug().
+		Int("count", len(watchlist)).
+		Msgf("Retrieved watchlist from %s", t.name)
+	return watchlist, nil
+}
+
+// AddToWatchlist adds movies and shows to the user's watchlist
+func (t *Client) AddToWatchlist(items []types.MediaSession) error {
+	movies := make([]map[string]interface{}, 0)
+	shows := make([]map[string]interface{}, 0)
+	for _, item := range items {
+		entry := map[string]interface{}{
+			"title": item.Title,
+			"year":  item.Year,
+			"ids":   traktIDs(item.IDs),
+		}
+		switch item.Type {
+		case "movie":
+			movies = append(movies, entry)
+		case "show":
+			shows = append(shows, entry)
+		}
+	}
+	if len(movies) == 0 && len(shows) == 0 {
+		return nil
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"movies": movies,
+		"shows":  shows,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal watchlist: %w", err)
+	}
+	req, err := http.NewRequest("POST", t.APIBaseURL+"/sync/watchlist", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := t.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("trakt API error %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
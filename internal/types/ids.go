@@ -0,0 +1,120 @@
+package types
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// IDs identify a movie, show or episode on external databases and on the servers that know it.
+// Empty fields are unknown.
+type IDs struct {
+	IMDB     string `json:"imdb,omitempty"`
+	TMDB     string `json:"tmdb,omitempty"`
+	TVDB     string `json:"tvdb,omitempty"`
+	Trakt    string `json:"trakt,omitempty"`
+	Slug     string `json:"slug,omitempty"` // Trakt slug
+	AniDB    string `json:"anidb,omitempty"`
+	Plex     string `json:"plex,omitempty"`     // Plex rating key
+	Jellyfin string `json:"jellyfin,omitempty"` // Emby or Jellyfin item ID
+}
+
+// IsZero reports whether no ID is known
+func (i IDs) IsZero() bool {
+	return i == IDs{}
+}
+
+// External returns the IDs shared across servers, with a prefix naming the database, e.g. "imdb:tt0111161".
+// Server-local IDs are left out.
+func (i IDs) External() []string {
+	var ids []string
+	for _, id := range []struct{ name, value string }{
+		{"imdb", i.IMDB},
+		{"tmdb", i.TMDB},
+		{"tvdb", i.TVDB},
+		{"trakt", i.Trakt},
+		{"anidb", i.AniDB},
+	} {
+		if id.value != "" {
+			ids = append(ids, id.name+":"+id.value)
+		}
+	}
+	return ids
+}
+
+// Keys returns the external IDs with the type of item they identify, e.g. "movie:tmdb:278". TMDB, TVDB
+// and Trakt number movies, shows and episodes separately, so IDs of items of mixed types need the type.
+func (i IDs) Keys(mediaType string) []string {
+	ids := i.External()
+	for j, id := range ids {
+		ids[j] = mediaType + ":" + id
+	}
+	return ids
+}
+
+// Matches reports whether both sets share an external ID. Both must be IDs of items of the same type.
+func (i IDs) Matches(other IDs) bool {
+	for _, id := range i.External() {
+		if slices.Contains(other.External(), id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge fills the IDs missing from i with those of other
+func (i *IDs) Merge(other IDs) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&i.IMDB, other.IMDB},
+		{&i.TMDB, other.TMDB},
+		{&i.TVDB, other.TVDB},
+		{&i.Trakt, other.Trakt},
+		{&i.Slug, other.Slug},
+		{&i.AniDB, other.AniDB},
+		{&i.Plex, other.Plex},
+		{&i.Jellyfin, other.Jellyfin},
+	} {
+		if *field.dst == "" {
+			*field.dst = field.src
+		}
+	}
+}
+
+// Set sets an external ID by the provider name used in Plex guids and Emby/Jellyfin provider IDs,
+// e.g. "imdb" or "Tvdb". Unknown providers are ignored.
+func (i *IDs) Set(provider, value string) {
+	if value == "" {
+		return
+	}
+	switch strings.ToLower(provider) {
+	case "imdb":
+		i.IMDB = value
+	case "tmdb":
+		i.TMDB = value
+	case "tvdb":
+		i.TVDB = value
+	case "trakt":
+		i.Trakt = value
+	case "anidb":
+		i.AniDB = value
+	}
+}
+
+// UnmarshalJSON reads sessions stored before IDs were grouped, such as old ledger entries
+func (m *MediaSession) UnmarshalJSON(data []byte) error {
+	type session MediaSession
+	var legacy struct {
+		session
+		IMDBID string `json:"imdb_id"`
+		TVDBID string `json:"tvdb_id"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	*m = MediaSession(legacy.session)
+	m.IDs.Merge(IDs{IMDB: legacy.IMDBID, TVDB: legacy.TVDBID})
+	return nil
+}
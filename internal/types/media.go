@@ -0,0 +1,120 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LibraryItem is a movie or episode in a server's library, with what is known about the file
+type LibraryItem struct {
+	Session MediaSession `json:"session"`
+	Media   MediaInfo    `json:"media"`
+	AddedAt int64        `json:"added_at"` // Unix time, 0 if unknown
+}
+
+// EpisodeNumbers are the numbers of an episode in each episode order. Zero values are unknown.
+type EpisodeNumbers struct {
+	Season    int    `json:"season"` // Aired order
+	Number    int    `json:"number"`
+	Absolute  int    `json:"absolute,omitempty"`
+	DVDSeason int    `json:"dvd_season,omitempty"`
+	DVDNumber int    `json:"dvd_number,omitempty"`
+	AirDate   string `json:"air_date,omitempty"` // YYYY-MM-DD
+}
+
+// MediaInfo describes a file using Trakt's collection values. Empty fields are unknown.
+type MediaInfo struct {
+	Resolution    string `json:"resolution,omitempty"`     // e.g. "hd_1080p", "uhd_4k"
+	HDR           string `json:"hdr,omitempty"`            // "dolby_vision", "hdr10", "hdr10_plus" or "hlg"
+	Audio         string `json:"audio,omitempty"`          // e.g. "dolby_truehd", "aac"
+	AudioChannels string `json:"audio_channels,omitempty"` // e.g. "5.1"
+}
+
+// ResolutionFromHeight converts the height of a video in pixels
+func ResolutionFromHeight(height int) string {
+	switch {
+	case height <= 0:
+		return ""
+	case height > 1100:
+		return "uhd_4k"
+	case height > 800:
+		return "hd_1080p"
+	case height > 576:
+		return "hd_720p"
+	case height > 480:
+		return "sd_576p"
+	default:
+		return "sd_480p"
+	}
+}
+
+// AudioChannelsFromCount converts a number of audio channels, e.g. 6 to "5.1"
+func AudioChannelsFromCount(channels int) string {
+	switch {
+	case channels <= 0:
+		return ""
+	case channels <= 2:
+		return fmt.Sprintf("%d.0", channels)
+	default:
+		// Layouts with more than two channels have a subwoofer
+		return fmt.Sprintf("%d.1", channels-1)
+	}
+}
+
+// audioCodecs maps codec names used by ffmpeg, Plex, Emby and Jellyfin to Trakt's values
+var audioCodecs = map[string]string{
+	"truehd": "dolby_truehd",
+	"eac3":   "dolby_digital_plus",
+	"ac3":    "dolby_digital",
+	"dca":    "dts",
+	"dts":    "dts",
+	"aac":    "aac",
+	"flac":   "flac",
+	"mp3":    "mp3",
+	"mp2":    "mp2",
+	"opus":   "ogg_opus",
+	"vorbis": "ogg",
+	"pcm":    "lpcm",
+}
+
+// dtsProfiles maps the DTS profile names of Plex and ffmpeg (used by Emby and Jellyfin) to Trakt's values
+var dtsProfiles = map[string]string{
+	"ma":                     "dts_ma",
+	"dts-hd ma":              "dts_ma",
+	"x":                      "dts_x",
+	"dts:x":                  "dts_x",
+	"dts-hd ma + dts:x":      "dts_x",
+	"dts-hd ma + dts:x imax": "dts_x",
+	"hra":                    "dts_hr",
+	"dts-hd hra":             "dts_hr",
+}
+
+// AudioFromCodec converts an audio codec name and profile, e.g. "dts" and "DTS-HD MA"
+func AudioFromCodec(codec, profile string) string {
+	codec = strings.ToLower(codec)
+	if strings.HasPrefix(codec, "pcm") {
+		codec = "pcm"
+	}
+	audio := audioCodecs[codec]
+	if dts, ok := dtsProfiles[strings.ToLower(profile)]; ok && audio == "dts" {
+		audio = dts
+	}
+	return audio
+}
+
+// HDRFromVideoRange converts a video range such as Jellyfin's "DOVIWithHDR10" or Emby's "HDR 10"
+func HDRFromVideoRange(videoRange string) string {
+	value := strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(videoRange))
+	switch {
+	case strings.Contains(value, "dovi") || strings.Contains(value, "dolbyvision"):
+		return "dolby_vision"
+	case strings.Contains(value, "hdr10plus") || strings.Contains(value, "hdr10+"):
+		return "hdr10_plus"
+	case strings.Contains(value, "hlg"):
+		return "hlg"
+	case strings.Contains(value, "hdr"):
+		return "hdr10"
+	default:
+		return ""
+	}
+}
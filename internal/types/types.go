@@ -2,11 +2,69 @@ package types
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 )
 
 func GetHistoryKey(session MediaSession) string {
-	return fmt.Sprintf("%s-%s-%s", session.Type, session.ShowTitle, session.EpisodeTitle)
+	return fmt.Sprintf("%s-%s-%s-%s", session.User.ID, session.Type, session.ShowTitle, session.Title)
+}
+
+// GetMediaKey identifies a movie or episode across servers by its titles, for when external IDs are missing
+func GetMediaKey(session MediaSession) string {
+	if session.Type == "episode" {
+		return fmt.Sprintf("episode-%s-%d-%d", strings.ToLower(session.ShowTitle), session.SeasonNum, session.EpisodeNum)
+	}
+	return fmt.Sprintf("%s-%s-%d", session.Type, strings.ToLower(session.Title), session.Year)
+}
+
+// SplitEpisodes returns a session for each episode of a file spanning several episodes, or the session
+// itself. Only the first episode keeps the IDs, title and air date of the file's item, the others keep
+// the show and are looked up by their season and episode numbers.
+func SplitEpisodes(session MediaSession) []MediaSession {
+	if session.Type != "episode" || session.EpisodeNumEnd <= session.EpisodeNum {
+		return []MediaSession{session}
+	}
+	episodes := make([]MediaSession, 0, session.EpisodeNumEnd-session.EpisodeNum+1)
+	first := session
+	first.EpisodeNumEnd = 0
+	episodes = append(episodes, first)
+	for number := session.EpisodeNum + 1; number <= session.EpisodeNumEnd; number++ {
+		episode := first
+		episode.EpisodeNum = number
+		episode.IDs = IDs{}
+		episode.Title = fmt.Sprintf("%s S%02dE%02d", session.ShowTitle, session.SeasonNum, number)
+		episode.EpisodeTitle = ""
+		episode.AirDate = ""
+		if session.AbsoluteNum != 0 {
+			episode.AbsoluteNum = session.AbsoluteNum + number - session.EpisodeNum
+		}
+		episodes = append(episodes, episode)
+	}
+	return episodes
+}
+
+// Rating is a user's rating of a movie or episode, on Trakt's scale of 1 to 10
+type Rating struct {
+	Session MediaSession `json:"session"` // The rated item
+	Value   int          `json:"value"`
+	RatedAt int64        `json:"rated_at"` // Unix time, 0 if the server does not record it
+}
+
+// RatingFromScale converts a rating out of scale, e.g. 3.5 out of 5 stars, to the 1-10 scale.
+// It returns 0 for a missing rating.
+func RatingFromScale(value, scale float64) int {
+	if value <= 0 || scale <= 0 {
+		return 0
+	}
+	rating := int(math.Round(value / scale * 10))
+	return min(max(rating, 1), 10)
+}
+
+// Scaled converts the rating to a scale, e.g. 5 for stars
+func (r Rating) Scaled(scale float64) float64 {
+	return float64(r.Value) / 10 * scale
 }
 
 type User struct {
@@ -15,33 +73,50 @@ type User struct {
 }
 
 type Library struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Type string `json:"type"` // "movie", "show", "music", etc.
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`                 // "movie", "show", "music", etc.
+	UpdatedAt int64  `json:"updated_at,omitempty"` // Unix time of the last change the server reports
 }
 
 // MediaSession represents a media playback session
 type MediaSession struct {
-	SessionID    string  `json:"session_id"`
-	Title        string  `json:"title"`
-	Year         int     `json:"year"`
-	Type         string  `json:"type"`  // "movie" or "episode"
-	State        string  `json:"state"` // "playing", "paused", "stopped"
-	Progress     float64 `json:"progress"`
-	Duration     int64   `json:"duration"`
-	ViewOffset   int64   `json:"view_offset"`
-	IMDBID       string  `json:"imdb_id"`
-	TVDBID       string  `json:"tvdb_id"`
-	SeasonNum    int     `json:"season_num"`
-	EpisodeNum   int     `json:"episode_num"`
-	ShowTitle    string  `json:"show_title"`
-	EpisodeTitle string  `json:"episode_title"`
-	ViewedAt     int64   `json:"viewed_at"`
-	User         User    `json:"user"` // User who is watching the session
-	Source       string  `json:"source"`
-	LibraryID    string  `json:"library_id"`
-	LibraryName  string  `json:"library_name"`
-	LibraryType  string  `json:"library_type"` // "movie", "show", "music", etc.
+	SessionID string `json:"session_id"`
+	Title     string `json:"title"`
+	// OriginalTitle is the title in the original language, when the server knows it
+	OriginalTitle string  `json:"original_title,omitempty"`
+	Year          int     `json:"year"`
+	Type          string  `json:"type"`  // "movie", "episode" or "track"
+	State         string  `json:"state"` // "playing", "paused", "stopped"
+	Progress      float64 `json:"progress"`
+	Duration      int64   `json:"duration"`
+	ViewOffset    int64   `json:"view_offset"`
+	IDs           IDs     `json:"ids"` // IDs of the movie, show or episode itself
+	SeasonNum     int     `json:"season_num"`
+	EpisodeNum    int     `json:"episode_num"`
+	EpisodeNumEnd int     `json:"episode_num_end,omitempty"` // Last episode of a file spanning several, e.g. 2 for S01E01-E02
+	AbsoluteNum   int     `json:"absolute_num,omitempty"`    // Episode number counted across seasons
+	AirDate       string  `json:"air_date,omitempty"`        // First air date of an episode, YYYY-MM-DD
+	ShowTitle     string  `json:"show_title"`
+	ShowIDs       IDs     `json:"show_ids"` // IDs of the show of an episode
+	EpisodeTitle  string  `json:"episode_title"`
+	ViewedAt      int64   `json:"viewed_at"`
+	PlayCount     int     `json:"play_count,omitempty"` // Times the user watched the item, when listing watched items
+	User          User    `json:"user"`                 // User who is watching the session
+	Source        string  `json:"source"`
+	Origin        string  `json:"origin,omitempty"` // Server the change first came from, when Scroblarr wrote it to the source
+	LibraryID     string  `json:"library_id"`
+	LibraryName   string  `json:"library_name"`
+	LibraryType   string  `json:"library_type"` // "movie", "show", "music", etc.
+
+	// Music metadata, set when Type is "track"
+	Artist        string   `json:"artist,omitempty"`
+	Album         string   `json:"album,omitempty"`
+	TrackNum      int      `json:"track_num,omitempty"`
+	RecordingMBID string   `json:"recording_mbid,omitempty"`
+	TrackMBID     string   `json:"track_mbid,omitempty"`
+	ReleaseMBID   string   `json:"release_mbid,omitempty"`
+	ArtistMBIDs   []string `json:"artist_mbids,omitempty"`
 }
 
 // MediaSessionHistory is a map of session type and title to MediaSession
@@ -0,0 +1,61 @@
+package types
+
+import "testing"
+
+func TestSplitEpisodes(t *testing.T) {
+	file := MediaSession{
+		Type:          "episode",
+		Title:         "Pilot",
+		ShowTitle:     "Lost",
+		EpisodeTitle:  "Pilot",
+		SeasonNum:     1,
+		EpisodeNum:    1,
+		EpisodeNumEnd: 3,
+		AbsoluteNum:   1,
+		AirDate:       "2004-09-22",
+		IDs:           IDs{TVDB: "127131"},
+		ShowIDs:       IDs{TVDB: "73739"},
+	}
+	tests := []struct {
+		name    string
+		session MediaSession
+		want    []int // Episode numbers
+	}{
+		{"movie", MediaSession{Type: "movie", Title: "Alien"}, []int{0}},
+		{"single episode", MediaSession{Type: "episode", SeasonNum: 1, EpisodeNum: 4}, []int{4}},
+		{"end before start", MediaSession{Type: "episode", SeasonNum: 1, EpisodeNum: 4, EpisodeNumEnd: 4}, []int{4}},
+		{"three episodes", file, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitEpisodes(tt.session)
+			if len(got) != len(tt.want) {
+				t.Fatalf("SplitEpisodes() returned %d sessions, want %d", len(got), len(tt.want))
+			}
+			for i, episode := range got {
+				if episode.EpisodeNum != tt.want[i] {
+					t.Errorf("episode %d is number %d, want %d", i, episode.EpisodeNum, tt.want[i])
+				}
+				if episode.EpisodeNumEnd != 0 && len(got) > 1 {
+					t.Errorf("episode %d still spans to %d", i, episode.EpisodeNumEnd)
+				}
+			}
+		})
+	}
+
+	episodes := SplitEpisodes(file)
+	if episodes[0].IDs != file.IDs || episodes[0].AirDate != file.AirDate {
+		t.Errorf("the first episode lost the IDs or air date of the file: %+v", episodes[0])
+	}
+	for _, episode := range episodes[1:] {
+		if episode.IDs != (IDs{}) || episode.AirDate != "" || episode.EpisodeTitle != "" {
+			t.Errorf("episode %d kept the IDs, air date or title of the first one", episode.EpisodeNum)
+		}
+		if episode.ShowTitle != file.ShowTitle || episode.ShowIDs != file.ShowIDs || episode.SeasonNum != file.SeasonNum {
+			t.Errorf("episode %d lost its show", episode.EpisodeNum)
+		}
+		if episode.AbsoluteNum != episode.EpisodeNum {
+			t.Errorf("episode %d has absolute number %d", episode.EpisodeNum, episode.AbsoluteNum)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"github.com/sirrobot01/scroblarr/internal/registry"
+	"github.com/sirrobot01/scroblarr/internal/types"
+	"github.com/sirrobot01/scroblarr/pkg/logger"
+	"github.com/sirrobot01/scroblarr/pkg/request"
+	"github.com/sirrobot01/scroblarr/pkg/version"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body when a secret is set
+const SignatureHeader = "X-Scroblarr-Signature"
+
+// defaultTemplate sends the whole event as JSON
+const defaultTemplate = `{{ toJson . }}`
+
+// Event is the data a webhook template is rendered with
+type Event struct {
+	Target    string             `json:"target"`
+	Action    string             `json:"action"`
+	Timestamp int64              `json:"timestamp"`
+	Session   types.MediaSession `json:"session"`
+}
+
+var funcs = template.FuncMap{
+	"toJson": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// Client implements the Server interface for outgoing webhooks
+type Client struct {
+	name        string
+	config      config.Server
+	logger      zerolog.Logger
+	client      *request.Client
+	template    *template.Template
+	lastActions map[string]string
+	mu          sync.Mutex
+}
+
+func init() {
+	registry.Register(registry.Definition{
+		ServerType: config.ServerType{
+			Name:  config.Webhook,
+			Label: "Webhook",
+			Fields: append([]config.Field{
+				{Name: "url", Label: "URL", Kind: config.FieldURL, Required: true},
+				{Name: "headers", Label: "Headers", Kind: config.FieldMap, Help: "One Name: value per line"},
+				{Name: "template", Label: "Template", Kind: config.FieldTextArea, Placeholder: defaultTemplate, Help: "Go text/template for the request body"},
+				{Name: "secret", Label: "Signing Secret", Kind: config.FieldPassword, Help: "Signs the body with HMAC-SHA256"},
+			}, config.RateLimitFields...),
+			Capabilities: []config.Capability{config.CapabilityScrobble, config.CapabilityHistoryWrite},
+		},
+		New: func(name string, cfg config.Server) (registry.Server, error) {
+			return New(name, cfg)
+		},
+	})
+}
+
+// New creates a new webhook client
+func New(name string, config config.Server) (*Client, error) {
+	if config.URL == "" {
+		return nil, registry.Permanent(fmt.Errorf("missing required URL"))
+	}
+
+	body := config.Template
+	if body == "" {
+		body = defaultTemplate
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, registry.Permanent(fmt.Errorf("invalid webhook template: %w", err))
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"User-Agent":   fmt.Sprintf("scroblarr/%s", version.GetInfo()),
+	}
+	for key, value := range config.Headers {
+		headers[key] = value
+	}
+	_logger := logger.NewLogger(name)
+	client := request.New(
+		request.WithHeaders(headers),
+		request.WithLogger(_logger),
+		request.WithTimeout(15*time.Second),
+		request.WithRateLimiter(config.RateLimiter()),
+		request.WithWriteRateLimiter(config.WriteRateLimiter()),
+	)
+
+	return &Client{
+		name:        name,
+		config:      config,
+		logger:      _logger,
+		client:      client,
+		template:    tmpl,
+		lastActions: make(map[string]string),
+	}, nil
+}
+
+// GetName returns the name of the server
+func (c *Client) GetName() string {
+	return c.name
+}
+
+// GetServerType returns the type of this server
+func (c *Client) GetServerType() string {
+	return "webhook"
+}
+
+func (c *Client) GetConfig() config.Server {
+	return c.config
+}
+
+func (c *Client) Connect() error {
+	// Nothing to connect to, the endpoint is only called on events
+	return nil
+}
+
+// Scrobble posts the rendered template when the action of a session changes
+func (c *Client) Scrobble(session types.MediaSession, action string) error {
+	key := types.GetHistoryKey(session)
+	c.mu.Lock()
+	unchanged := c.lastActions[key] == action
+	c.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	if err := c.send(session, action); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if action == "stop" {
+		delete(c.lastActions, key)
+	} else {
+		c.lastActions[key] = action
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// SyncHistory posts a completed item as a "scrobble" event
+func (c *Client) SyncHistory(session types.MediaSession) error {
+	return c.send(session, "scrobble")
+}
+
+// Preview returns the body the webhook would be sent for a session
+func (c *Client) Preview(session types.MediaSession, action string) (string, error) {
+	body, err := c.render(session, action)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// render fills in the template for an event
+func (c *Client) render(session types.MediaSession, action string) ([]byte, error) {
+	event := Event{
+		Target:    c.name,
+		Action:    action,
+		Timestamp: time.Now().Unix(),
+		Session:   session,
+	}
+	var body bytes.Buffer
+	if err := c.template.Execute(&body, event); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+func (c *Client) send(session types.MediaSession, action string) error {
+	body, err := c.render(session, action)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(c.config.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned error %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	c.logger.Trace().
+		Str("action", action).
+		Str("title", session.Title).
+		Msgf("Sent webhook to %s", c.name)
+	return nil
+}
@@ -10,11 +10,31 @@ import (
 
 func main() {
 	var configPath string
+	var dryRun bool
 	flag.StringVar(&configPath, "config", "/data", "path to the data folder")
+	flag.BoolVar(&dryRun, "dry-run", false, "record the writes to the targets in the ledger instead of sending them")
 	flag.Parse()
 
 	config.SetConfigPath(configPath)
+	config.SetDryRun(dryRun)
 	config.Get() // This will initialize the config
+
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "export":
+			if err := scroblarr.Export(args[1:]); err != nil {
+				log.Fatal(err)
+			}
+		case "summary":
+			if err := scroblarr.Summary(args[1:]); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			log.Fatalf("unknown command: %s", args[0])
+		}
+		return
+	}
+
 	ctx := context.Background()
 	if err := scroblarr.Start(ctx); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,138 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxPause caps how long a server can pause the client, so a bad header cannot stall it for hours
+const maxPause = 5 * time.Minute
+
+// ErrRateLimited is returned instead of waiting while the server asked the client to pause, so
+// callers such as the session poll are never held up. The request can be tried again later.
+var ErrRateLimited = errors.New("rate limited")
+
+// rateLimitHeader is the JSON X-Ratelimit header sent by Trakt
+type rateLimitHeader struct {
+	Name      string    `json:"name"`   // e.g. "AUTHED_API_POST_LIMIT"
+	Period    int       `json:"period"` // Seconds
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Until     time.Time `json:"until"`
+}
+
+// isWrite reports whether a request changes data
+func isWrite(req *http.Request) bool {
+	return req.Method != http.MethodGet && req.Method != http.MethodHead
+}
+
+// checkPaused returns ErrRateLimited if the server asked the client to wait before sending a request
+// of this kind. A pause after a read holds every request, one after a write only the writes.
+func (c *Client) checkPaused(req *http.Request) error {
+	c.limitsLock.Lock()
+	until := c.pausedUntil
+	if isWrite(req) && c.writesPausedUntil.After(until) {
+		until = c.writesPausedUntil
+	}
+	c.limitsLock.Unlock()
+	if time.Now().Before(until) {
+		return fmt.Errorf("%w by %s until %s", ErrRateLimited, req.URL.Host, until.Format(time.TimeOnly))
+	}
+	return nil
+}
+
+// pause holds the requests of the same kind as req until the given time
+func (c *Client) pause(req *http.Request, until time.Time) {
+	until = minTime(until, time.Now().Add(maxPause))
+	c.limitsLock.Lock()
+	defer c.limitsLock.Unlock()
+	pausedUntil := &c.pausedUntil
+	if isWrite(req) {
+		pausedUntil = &c.writesPausedUntil
+	}
+	if until.After(*pausedUntil) {
+		*pausedUntil = until
+	}
+}
+
+// adaptLimits follows the Retry-After and rate limit headers of a response. Requests of the same kind
+// are paused until the limit resets, and the limiter for the request's kind is lowered to the published rate.
+func (c *Client) adaptLimits(req *http.Request, resp *http.Response) {
+	now := time.Now()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+			c.pause(req, now.Add(wait))
+		}
+	}
+
+	if value := resp.Header.Get("X-Ratelimit"); value != "" {
+		var header rateLimitHeader
+		if err := json.Unmarshal([]byte(value), &header); err == nil {
+			if header.Remaining <= 0 && !header.Until.IsZero() {
+				c.pause(req, header.Until)
+			}
+			if header.Limit > 0 && header.Period > 0 {
+				c.lowerLimit(req, rate.Every(time.Duration(header.Period)*time.Second/time.Duration(header.Limit)))
+			}
+		}
+	}
+
+	// The de facto standard headers, with the reset as seconds or a Unix time
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining > 0 {
+		return
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if reset > 1e9 {
+			c.pause(req, time.Unix(reset, 0))
+		} else {
+			c.pause(req, now.Add(time.Duration(reset)*time.Second))
+		}
+	}
+}
+
+// lowerLimit slows the limiter for a request's kind down to limit, creating it if needed. Write
+// limits never slow down reads.
+func (c *Client) lowerLimit(req *http.Request, limit rate.Limit) {
+	c.limitsLock.Lock()
+	defer c.limitsLock.Unlock()
+	limiter := &c.rateLimiter
+	if isWrite(req) {
+		limiter = &c.writeLimiter
+	}
+	switch {
+	case *limiter == nil:
+		*limiter = rate.NewLimiter(limit, 1)
+	case limit < (*limiter).Limit():
+		(*limiter).SetLimit(limit)
+	default:
+		return
+	}
+	c.logger.Debug().Msgf("Limiting requests to %s to %.2f/s", req.URL.Host, float64(limit))
+}
+
+// parseRetryAfter parses a Retry-After header, given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -2,8 +2,8 @@ package request
 
 import (
 	"bytes"
-	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
@@ -12,6 +12,7 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -19,14 +20,18 @@ type ClientOption func(*Client)
 
 // Client represents an HTTP client with additional capabilities
 type Client struct {
-	client          *http.Client
-	rateLimiter     *rate.Limiter
-	headers         map[string]string
-	maxRetries      int
-	timeout         time.Duration
-	skipTLSVerify   bool
-	retryableStatus map[int]bool
-	logger          zerolog.Logger
+	client            *http.Client
+	rateLimiter       *rate.Limiter
+	writeLimiter      *rate.Limiter // Applies to requests other than GET and HEAD, on top of rateLimiter
+	pausedUntil       time.Time     // Set when the server asks to slow down
+	writesPausedUntil time.Time     // Set when the server asks to slow down writes
+	limitsLock        sync.Mutex
+	headers           map[string]string
+	maxRetries        int
+	timeout           time.Duration
+	skipTLSVerify     bool
+	retryableStatus   map[int]bool
+	logger            zerolog.Logger
 }
 
 // WithMaxRetries sets the maximum number of retry attempts
@@ -50,6 +55,13 @@ func WithRateLimiter(rl *rate.Limiter) ClientOption {
 	}
 }
 
+// WithWriteRateLimiter sets a rate limiter for requests that change data, such as POST
+func WithWriteRateLimiter(rl *rate.Limiter) ClientOption {
+	return func(c *Client) {
+		c.writeLimiter = rl
+	}
+}
+
 // WithHeaders sets default headers
 func WithHeaders(headers map[string]string) ClientOption {
 	return func(c *Client) {
@@ -74,14 +86,31 @@ func WithRetryableStatus(statusCodes ...int) ClientOption {
 
 // doRequest performs a single HTTP request with rate limiting
 func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
-	if c.rateLimiter != nil {
-		err := c.rateLimiter.Wait(req.Context())
-		if err != nil {
+	if err := c.checkPaused(req); err != nil {
+		return nil, err
+	}
+	c.limitsLock.Lock()
+	limiters := []*rate.Limiter{c.rateLimiter}
+	if isWrite(req) {
+		limiters = append(limiters, c.writeLimiter)
+	}
+	c.limitsLock.Unlock()
+
+	for _, limiter := range limiters {
+		if limiter == nil {
+			continue
+		}
+		if err := limiter.Wait(req.Context()); err != nil {
 			return nil, fmt.Errorf("rate limiter wait: %w", err)
 		}
 	}
 
-	return c.client.Do(req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.adaptLimits(req, resp)
+	return resp, nil
 }
 
 // Do performs an HTTP request with retries for certain status codes
@@ -98,14 +127,7 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		req.Body.Close()
 	}
 
-	// Apply timeout to the request context if not already present
-	if c.timeout > 0 {
-		var cancel context.CancelFunc
-		ctx := req.Context()
-		ctx, cancel = context.WithTimeout(ctx, c.timeout)
-		defer cancel()
-		req = req.WithContext(ctx)
-	}
+	// The timeout is applied by the http.Client to each attempt, including reading the body
 
 	backoff := time.Millisecond * 500
 	var resp *http.Response
@@ -124,6 +146,9 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		}
 
 		resp, err = c.doRequest(req)
+		if errors.Is(err, ErrRateLimited) {
+			return nil, err
+		}
 		if err != nil {
 			// Check if this is a network error that might be worth retrying
 			if attempt < c.maxRetries {
@@ -153,6 +178,11 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		// Close the response body before retrying
 		resp.Body.Close()
 
+		// A Retry-After or rate limit header paused the client, retrying now would be refused
+		if err := c.checkPaused(req); err != nil {
+			return nil, err
+		}
+
 		// Apply backoff with jitter
 		jitter := time.Duration(rand.Int63n(int64(backoff / 4)))
 		sleepTime := backoff + jitter
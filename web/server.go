@@ -8,6 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
+	"github.com/sirrobot01/scroblarr/internal/export"
+	"github.com/sirrobot01/scroblarr/internal/ledger"
+	"github.com/sirrobot01/scroblarr/internal/media_servers"
+	"github.com/sirrobot01/scroblarr/internal/trakt"
+	"github.com/sirrobot01/scroblarr/internal/types"
 	"github.com/sirrobot01/scroblarr/pkg/logger"
 	"html/template"
 	"net/http"
@@ -26,10 +31,11 @@ var templateFS embed.FS
 type Server struct {
 	templates *template.Template
 	logger    zerolog.Logger
+	servers   *media_servers.Pool
 }
 
 // New creates a new web UI server
-func New() *Server {
+func New(servers *media_servers.Pool) *Server {
 
 	// Create a new template with functions, then parse files
 	tmpl := template.New("")
@@ -38,6 +44,7 @@ func New() *Server {
 	return &Server{
 		templates: templates,
 		logger:    logger.NewLogger("web"),
+		servers:   servers,
 	}
 }
 
@@ -45,14 +52,18 @@ func New() *Server {
 func (s *Server) Start(ctx context.Context) error {
 	cfg := config.Get()
 	// Set up API routes
-	//http.HandleFunc("/api/config", s.handleConfig)
+	http.HandleFunc("/api/config", s.requireLogin(s.handleConfig))
+	http.HandleFunc("/api/server-types", s.handleServerTypes)
+	http.HandleFunc("/api/health", s.handleHealth)
 	http.HandleFunc("/api/auth/trakt", s.handleTraktAuth)
 	http.HandleFunc("/api/auth/trakt/poll", s.handleTraktPoll)
+	http.HandleFunc("/api/export/letterboxd", s.handleLetterboxdExport)
+	http.HandleFunc("/api/dry-run", s.handleDryRun)
 
 	// Set up simple page handlers that just serve the base HTML
 	http.HandleFunc("/", s.IndexHandler)
 	http.HandleFunc("/auth", s.AuthHandler)
-	http.HandleFunc("/settings", s.ConfigHandler)
+	http.HandleFunc("/settings", s.requireLogin(s.ConfigHandler))
 
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Port)
@@ -84,12 +95,22 @@ func (s *Server) Stop() {
 	s.logger.Info().Msg("Shutting down gracefully...")
 }
 
-// IndexHandler renders the single-page app shell
-func (s *Server) IndexHandler(w http.ResponseWriter, r *http.Request) {
+// pageData returns the template data shared by all pages
+func (s *Server) pageData(page, title string) map[string]any {
 	data := map[string]any{
-		"Page":  "index",
-		"Title": "",
+		"Page":  page,
+		"Title": title,
 	}
+	if authError := trakt.LoginError(); authError != "" {
+		data["TraktAuthError"] = authError
+	}
+	return data
+}
+
+// IndexHandler renders the single-page app shell
+func (s *Server) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	data := s.pageData("index", "")
+	data["Servers"] = s.servers.Names()
 	if err := s.templates.ExecuteTemplate(w, "layout", data); err != nil {
 		http.Error(w, fmt.Sprintf("Error rendering template: %v", err), http.StatusInternalServerError)
 	}
@@ -97,71 +118,121 @@ func (s *Server) IndexHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) AuthHandler(w http.ResponseWriter, r *http.Request) {
 	cfg := config.Get()
-	data := map[string]any{
-		"Page":              "auth",
-		"Title":             "Authentication",
-		"TraktEnabled":      cfg.TraktEnabled,
-		"TraktClientID":     cfg.TraktDetails.ClientID,
-		"TraktClientSecret": cfg.TraktDetails.ClientSecret,
-	}
+	data := s.pageData("auth", "Authentication")
+	data["TraktEnabled"] = cfg.TraktEnabled
+	data["TraktClientID"] = cfg.GetTraktClientID()
+	data["TraktClientSecret"] = cfg.TraktDetails.ClientSecret
 	if err := s.templates.ExecuteTemplate(w, "layout", data); err != nil {
 		http.Error(w, fmt.Sprintf("Error rendering template: %v", err), http.StatusInternalServerError)
 	}
 }
 
 func (s *Server) ConfigHandler(w http.ResponseWriter, r *http.Request) {
-	data := map[string]any{
-		"Page":  "settings",
-		"Title": "Settings",
-	}
+	data := s.pageData("settings", "Settings")
+	data["TraktEnabled"] = config.Get().TraktEnabled
 	if err := s.templates.ExecuteTemplate(w, "layout", data); err != nil {
 		http.Error(w, fmt.Sprintf("Error rendering template: %v", err), http.StatusInternalServerError)
 	}
 }
 
-// handleConfigAPI handles the API for getting/updating configuration
-func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+// handleServerTypes returns the registered server types and the fields each of them uses
+func (s *Server) handleServerTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(config.ServerTypes()); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to encode server types")
+	}
+}
 
-	if r.Method == http.MethodGet {
-		// Return current config
-		cfg := config.Get()
-		err := json.NewEncoder(w).Encode(cfg)
-		if err != nil {
-			return
-		}
+// handleHealth returns the connection state of every configured server
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.servers.Health()); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to encode server health")
+	}
+}
 
-	if r.Method == http.MethodPost {
-		// Update config
-		var cfg config.Config
-		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
-			http.Error(w, fmt.Sprintf("Error parsing request: %v", err), http.StatusBadRequest)
-			return
-		}
-		// Validate
-		if err := cfg.Validate(); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid configuration: %v", err), http.StatusBadRequest)
+// handleDryRun returns the would-send, unmatched and filtered counts of the dry runs
+// since a duration ago, 24h by default, optionally for a single sync
+func (s *Server) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	since := 24 * time.Hour
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = time.ParseDuration(value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since: %v", err), http.StatusBadRequest)
 			return
 		}
+	}
+	filter := ledger.Filter{Sync: r.URL.Query().Get("sync"), DryRun: true}
+	if since > 0 {
+		filter.From = time.Now().Add(-since)
+	}
+	entries, err := ledger.Get().Query(filter)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to read ledger")
+		http.Error(w, fmt.Sprintf("Failed to read ledger: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ledger.Summarize(entries)); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to encode dry run summary")
+	}
+}
 
-		// Save to file
+// handleLetterboxdExport downloads the movie history as a Letterboxd import CSV
+func (s *Server) handleLetterboxdExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-		if err := cfg.Save(); err != nil {
-			http.Error(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
-			return
-		}
+	filter, err := export.ParseFilter(r.URL.Query().Get("from"), r.URL.Query().Get("to"), r.URL.Query().Get("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		w.WriteHeader(http.StatusOK)
-		err := json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-		if err != nil {
+	var movies []types.MediaSession
+	var ratings []types.Rating
+	source := r.URL.Query().Get("source")
+	if source == "" || source == "ledger" {
+		movies, err = export.FromLedger(filter)
+		if err == nil {
+			ratings, err = export.RatingsFromLedger(filter)
+		}
+	} else {
+		server, ok := s.servers.Get(source)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Server %s is not configured or not reachable", source), http.StatusBadRequest)
 			return
 		}
+		movies, err = export.FromServer(server, filter)
+		if err == nil {
+			ratings, err = export.RatingsFromServer(server)
+		}
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to export history")
+		http.Error(w, fmt.Sprintf("Failed to export history: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="letterboxd.csv"`)
+	if err := export.Letterboxd(w, movies, ratings); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to write Letterboxd export")
+	}
 }
 
 // handleTraktDeviceAuth initiates the Trakt device authentication flow
@@ -176,7 +247,7 @@ func (s *Server) handleTraktAuth(w http.ResponseWriter, r *http.Request) {
 
 	clientId := r.FormValue("client_id")
 	if clientId == "" {
-		clientId = cfg.TraktDetails.ClientID
+		clientId = cfg.GetTraktClientID()
 	}
 	if clientId == "" {
 		http.Error(w, "Client ID is required", http.StatusBadRequest)
@@ -189,7 +260,7 @@ func (s *Server) handleTraktAuth(w http.ResponseWriter, r *http.Request) {
 	}
 	jsonPayload, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", "https://api.trakt.tv/oauth/device/code", bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequest("POST", cfg.GetTraktAPIURL()+"/oauth/device/code", bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		http.Error(w, "Failed to create request", http.StatusInternalServerError)
 		return
@@ -219,8 +290,10 @@ func (s *Server) handleTraktAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update config with client id
-	cfg.TraktDetails.ClientID = clientId
+	// Update config with client id, unless it already comes from the environment or the default app
+	if clientId != cfg.GetTraktClientID() {
+		cfg.TraktDetails.ClientID = clientId
+	}
 	if err := cfg.Save(); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to save config: %v", err), http.StatusInternalServerError)
 		return
@@ -247,7 +320,7 @@ func (s *Server) handleTraktPoll(w http.ResponseWriter, r *http.Request) {
 
 	clientId := r.FormValue("client_id")
 	if clientId == "" {
-		clientId = cfg.TraktDetails.ClientID
+		clientId = cfg.GetTraktClientID()
 	}
 	if clientId == "" {
 		http.Error(w, "Client ID is required", http.StatusBadRequest)
@@ -256,7 +329,7 @@ func (s *Server) handleTraktPoll(w http.ResponseWriter, r *http.Request) {
 
 	clientSecret := r.FormValue("client_secret")
 	if clientSecret == "" {
-		clientSecret = cfg.TraktDetails.ClientSecret
+		clientSecret = cfg.GetTraktClientSecret()
 	}
 	if clientSecret == "" {
 		http.Error(w, "Client secret is required", http.StatusBadRequest)
@@ -280,7 +353,7 @@ func (s *Server) handleTraktPoll(w http.ResponseWriter, r *http.Request) {
 	}
 	jsonPayload, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", "https://api.trakt.tv/oauth/device/token", bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequest("POST", cfg.GetTraktAPIURL()+"/oauth/device/token", bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		http.Error(w, "Failed to create request", http.StatusInternalServerError)
 		return
@@ -314,9 +387,13 @@ func (s *Server) handleTraktPoll(w http.ResponseWriter, r *http.Request) {
 			"success": "true",
 		}
 
-		// Update config with client id and secret
-		cfg.TraktDetails.ClientID = clientId
-		cfg.TraktDetails.ClientSecret = clientSecret
+		// Update config with client id and secret, unless they already come from the environment
+		if clientId != cfg.GetTraktClientID() {
+			cfg.TraktDetails.ClientID = clientId
+		}
+		if clientSecret != cfg.GetTraktClientSecret() {
+			cfg.TraktDetails.ClientSecret = clientSecret
+		}
 		if err := cfg.Save(); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to save config: %v", err), http.StatusInternalServerError)
 			return
@@ -362,23 +439,8 @@ func (s *Server) handleTraktPoll(w http.ResponseWriter, r *http.Request) {
 
 // saveTraktToken saves the Trakt access token to configuration
 func (s *Server) saveTraktToken(token traktTokenResponse) error {
-	// Get current config
-	cfg := config.Get()
-
-	trakt := cfg.Trakt
-	if trakt == nil {
-		trakt = &config.Trakt{}
-	}
-
-	trakt.AccessToken = token.AccessToken
-	trakt.RefreshToken = token.RefreshToken
-	trakt.ExpiresIn = token.ExpiresIn
-	trakt.TokenType = token.TokenType
-
-	// Update config
-	cfg.Trakt = trakt
-	// Save config
-	if err := cfg.SaveTrakt(); err != nil {
+	// The clients may be refreshing the same tokens, so they are replaced through the trakt package
+	if err := trakt.SaveLogin(token.AccessToken, token.RefreshToken, token.TokenType, token.ExpiresIn, token.CreatedAt); err != nil {
 		return fmt.Errorf("failed to save Trakt token: %w", err)
 	}
 	return nil
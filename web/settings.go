@@ -0,0 +1,144 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"net/http"
+)
+
+// redacted stands in for the secrets sent to the Settings page. Saving it back keeps the stored secret.
+const redacted = "********"
+
+// settings are the options edited on the Settings page
+type settings struct {
+	Servers  map[string]config.Server `json:"servers"`
+	Interval string                   `json:"interval"`
+	LogLevel string                   `json:"log_level"`
+	Port     int                      `json:"port"`
+}
+
+// requireLogin serves a handler only to requests with the web login of the config
+func (s *Server) requireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		login := config.Get().Web
+		if login.Username == "" || login.Password == "" {
+			http.Error(w, "Set web.username and web.password in config.yaml to use the settings", http.StatusForbidden)
+			return
+		}
+		username, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(login.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(login.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Scroblarr", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleConfig returns the settings with their secrets redacted, or saves them
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	current := config.Get()
+
+	switch r.Method {
+	case http.MethodGet:
+		servers := make(map[string]config.Server, len(current.Servers))
+		for name, server := range current.Servers {
+			servers[name] = redactServer(server)
+		}
+		data := settings{Servers: servers, Interval: current.Interval, LogLevel: current.LogLevel, Port: current.Port}
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to encode settings")
+		}
+
+	case http.MethodPost:
+		var data settings
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing request: %v", err), http.StatusBadRequest)
+			return
+		}
+		// Update a copy of the current config, so settings the page does not edit are kept
+		cfg := *current
+		cfg.Interval = data.Interval
+		cfg.LogLevel = data.LogLevel
+		cfg.Port = data.Port
+		if data.Servers != nil {
+			cfg.Servers = make(map[string]config.Server, len(data.Servers))
+			for name, server := range data.Servers {
+				server, err := unredactServer(server, current.Servers[name])
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid configuration: server %s: %v", name, err), http.StatusBadRequest)
+					return
+				}
+				cfg.Servers[name] = server
+			}
+		}
+		if err := cfg.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid configuration: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// Save to file, the running syncs keep the config they started with until a restart
+		if err := cfg.Write(); err != nil {
+			http.Error(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]string{"status": "success"}); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to encode response")
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// redactServer replaces the secrets of a server, and the values of its headers, which often carry them
+func redactServer(server config.Server) config.Server {
+	for _, secret := range []*string{&server.Token, &server.Password, &server.Secret} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	if server.Headers != nil {
+		headers := make(map[string]string, len(server.Headers))
+		for name := range server.Headers {
+			headers[name] = redacted
+		}
+		server.Headers = headers
+	}
+	return server
+}
+
+// unredactServer puts back the stored secrets of a server saved with redacted values
+func unredactServer(server, current config.Server) (config.Server, error) {
+	for _, secret := range []struct {
+		value   *string
+		current string
+	}{
+		{&server.Token, current.Token},
+		{&server.Password, current.Password},
+		{&server.Secret, current.Secret},
+	} {
+		if *secret.value != redacted {
+			continue
+		}
+		if secret.current == "" {
+			return server, fmt.Errorf("enter its secrets again")
+		}
+		*secret.value = secret.current
+	}
+	for name, value := range server.Headers {
+		if value != redacted {
+			continue
+		}
+		stored, ok := current.Headers[name]
+		if !ok {
+			return server, fmt.Errorf("enter the value of header %s again", name)
+		}
+		server.Headers[name] = stored
+	}
+	return server, nil
+}
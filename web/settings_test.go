@@ -0,0 +1,69 @@
+package web
+
+import (
+	"github.com/sirrobot01/scroblarr/internal/config"
+	"maps"
+	"testing"
+)
+
+func TestRedactServer(t *testing.T) {
+	stored := config.Server{
+		Type:     "webhook",
+		URL:      "https://example.com/hook",
+		Token:    "token",
+		Password: "password",
+		Secret:   "secret",
+		Headers:  map[string]string{"Authorization": "Bearer abc"},
+	}
+	shown := redactServer(stored)
+	if shown.Token != redacted || shown.Password != redacted || shown.Secret != redacted || shown.Headers["Authorization"] != redacted {
+		t.Fatalf("secrets were sent: %+v", shown)
+	}
+	if shown.URL != stored.URL || stored.Headers["Authorization"] != "Bearer abc" {
+		t.Fatalf("redacting changed other values or the stored server: %+v, %+v", shown, stored)
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(*config.Server)
+		want    config.Server
+		wantErr bool
+	}{
+		{"unchanged", func(*config.Server) {}, stored, false},
+		{
+			"new token",
+			func(s *config.Server) { s.Token = "new" },
+			config.Server{Type: "webhook", URL: stored.URL, Token: "new", Password: "password", Secret: "secret", Headers: stored.Headers},
+			false,
+		},
+		{
+			"new header",
+			func(s *config.Server) { s.Headers["X-Key"] = "key" },
+			config.Server{Type: "webhook", URL: stored.URL, Token: "token", Password: "password", Secret: "secret",
+				Headers: map[string]string{"Authorization": "Bearer abc", "X-Key": "key"}},
+			false,
+		},
+		{"redacted header that was not stored", func(s *config.Server) { s.Headers["X-Key"] = redacted }, config.Server{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := redactServer(stored)
+			tt.edit(&server)
+			got, err := unredactServer(server, stored)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unredactServer() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Token != tt.want.Token || got.Password != tt.want.Password || got.Secret != tt.want.Secret ||
+				got.URL != tt.want.URL || !maps.Equal(got.Headers, tt.want.Headers) {
+				t.Errorf("unredactServer() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := unredactServer(config.Server{Token: redacted}, config.Server{}); err == nil {
+		t.Error("a redacted secret of a new server was accepted")
+	}
+}